@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+type atomicFile interface {
+	io.Writer
+	Name() string
+	Chmod(mode os.FileMode) error
+	Chown(uid, gid int) error
+	Sync() error
+	Close() error
+}
+
+// fileSystem abstracts the file operations needed for atomic writes, so failures can be injected in tests.
+type fileSystem interface {
+	Stat(name string) (os.FileInfo, error)
+	CreateTemp(dir, pattern string) (atomicFile, error)
+	CopySecurityContext(src, dst string) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	SyncDir(dir string) error
+}
+
+type osFileSystem struct{}
+
+func (o osFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (o osFileSystem) CreateTemp(dir, pattern string) (atomicFile, error) {
+	return os.CreateTemp(dir, pattern)
+}
+
+func (o osFileSystem) CopySecurityContext(src, dst string) error {
+	return copySecurityContext(src, dst)
+}
+
+func (o osFileSystem) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (o osFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (o osFileSystem) SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// writeFileAtomic replaces the file at path with data without ever exposing a partially written file. The data is
+// written to a temporary file in the same directory which inherits mode, owner and security context of the existing
+// file, synced to disk and then renamed over the original file. Finally, the directory is synced to persist the
+// rename. If the file does not exist yet, it's created using defaultMode. Symlinks are resolved first, so the target
+// is replaced instead of the link.
+func writeFileAtomic(fsys fileSystem, path string, data []byte, defaultMode os.FileMode) (err error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	switch {
+	case err == nil:
+		path = resolved
+	case !errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("could not resolve %q: %w", path, err)
+	}
+
+	mode := defaultMode
+	uid, gid := -1, -1
+	exists := false
+
+	info, err := fsys.Stat(path)
+	switch {
+	case err == nil:
+		exists = true
+		mode = info.Mode().Perm()
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			uid, gid = int(stat.Uid), int(stat.Gid)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("could not stat %q: %w", path, err)
+	}
+
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := fsys.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("could not create temporary file: %w", err)
+	}
+
+	renamed := false
+	defer func() {
+		if !renamed {
+			_ = tmp.Close()
+			if removeErr := fsys.Remove(tmp.Name()); removeErr != nil && !errors.Is(removeErr, fs.ErrNotExist) {
+				err = errors.Join(err, fmt.Errorf("could not remove temporary file: %w", removeErr))
+			}
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return fmt.Errorf("could not write temporary file: %w", err)
+	}
+
+	if err := tmp.Chmod(mode); err != nil {
+		return fmt.Errorf("could not set mode of temporary file: %w", err)
+	}
+
+	if exists {
+		if uid >= 0 && gid >= 0 {
+			if err := tmp.Chown(uid, gid); err != nil {
+				return fmt.Errorf("could not set owner of temporary file: %w", err)
+			}
+		}
+
+		if err := fsys.CopySecurityContext(path, tmp.Name()); err != nil {
+			return fmt.Errorf("could not copy security context: %w", err)
+		}
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("could not sync temporary file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not close temporary file: %w", err)
+	}
+
+	if err := fsys.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("could not rename temporary file: %w", err)
+	}
+	renamed = true
+
+	if err := fsys.SyncDir(dir); err != nil {
+		return fmt.Errorf("could not sync directory %q: %w", dir, err)
+	}
+
+	return nil
+}
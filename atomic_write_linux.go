@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+const selinuxXattr = "security.selinux"
+
+// copySecurityContext copies the SELinux label of src to dst. Systems without SELinux are silently ignored.
+func copySecurityContext(src, dst string) error {
+	buf := make([]byte, 256)
+	for {
+		n, err := syscall.Getxattr(src, selinuxXattr, buf)
+		if errors.Is(err, syscall.ERANGE) {
+			buf = make([]byte, len(buf)*2)
+			continue
+		}
+		if errors.Is(err, syscall.ENODATA) || errors.Is(err, syscall.ENOTSUP) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return syscall.Setxattr(dst, selinuxXattr, buf[:n], 0)
+	}
+}
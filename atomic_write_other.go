@@ -0,0 +1,7 @@
+//go:build !linux
+
+package main
+
+func copySecurityContext(_, _ string) error {
+	return nil
+}
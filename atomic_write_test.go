@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var errInjected = errors.New("injected failure")
+
+type faultyFile struct {
+	atomicFile
+	failAt string
+}
+
+func (f *faultyFile) Write(p []byte) (int, error) {
+	if f.failAt == "write" {
+		// simulate a full disk after writing parts of the data
+		n, _ := f.atomicFile.Write(p[:len(p)/2])
+		return n, errInjected
+	}
+	return f.atomicFile.Write(p)
+}
+
+func (f *faultyFile) Chmod(mode os.FileMode) error {
+	if f.failAt == "chmod" {
+		return errInjected
+	}
+	return f.atomicFile.Chmod(mode)
+}
+
+func (f *faultyFile) Chown(uid, gid int) error {
+	if f.failAt == "chown" {
+		return errInjected
+	}
+	return f.atomicFile.Chown(uid, gid)
+}
+
+func (f *faultyFile) Sync() error {
+	if f.failAt == "sync" {
+		return errInjected
+	}
+	return f.atomicFile.Sync()
+}
+
+func (f *faultyFile) Close() error {
+	if f.failAt == "close" {
+		_ = f.atomicFile.Close()
+		return errInjected
+	}
+	return f.atomicFile.Close()
+}
+
+type faultyFileSystem struct {
+	osFileSystem
+	failAt string
+}
+
+func (f *faultyFileSystem) Stat(name string) (os.FileInfo, error) {
+	if f.failAt == "stat" {
+		return nil, errInjected
+	}
+	return f.osFileSystem.Stat(name)
+}
+
+func (f *faultyFileSystem) CreateTemp(dir, pattern string) (atomicFile, error) {
+	if f.failAt == "create" {
+		return nil, errInjected
+	}
+	file, err := f.osFileSystem.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyFile{atomicFile: file, failAt: f.failAt}, nil
+}
+
+func (f *faultyFileSystem) CopySecurityContext(src, dst string) error {
+	if f.failAt == "security_context" {
+		return errInjected
+	}
+	return f.osFileSystem.CopySecurityContext(src, dst)
+}
+
+func (f *faultyFileSystem) Rename(oldpath, newpath string) error {
+	if f.failAt == "rename" {
+		return errInjected
+	}
+	return f.osFileSystem.Rename(oldpath, newpath)
+}
+
+func (f *faultyFileSystem) SyncDir(dir string) error {
+	if f.failAt == "sync_dir" {
+		return errInjected
+	}
+	return f.osFileSystem.SyncDir(dir)
+}
+
+func Test_writeFileAtomic(t *testing.T) {
+	const (
+		original = "ListenAddress 0.0.0.0\n"
+		updated  = "ListenAddress 10.8.0.1\n"
+	)
+
+	tests := []struct {
+		name        string
+		failAt      string
+		wantErr     bool
+		wantContent string
+	}{
+		{name: "happy case", failAt: "", wantErr: false, wantContent: updated},
+		{name: "stat fails", failAt: "stat", wantErr: true, wantContent: original},
+		{name: "creating temp file fails", failAt: "create", wantErr: true, wantContent: original},
+		{name: "disk full while writing", failAt: "write", wantErr: true, wantContent: original},
+		{name: "chmod fails", failAt: "chmod", wantErr: true, wantContent: original},
+		{name: "chown fails", failAt: "chown", wantErr: true, wantContent: original},
+		{name: "copying security context fails", failAt: "security_context", wantErr: true, wantContent: original},
+		{name: "sync fails", failAt: "sync", wantErr: true, wantContent: original},
+		{name: "close fails", failAt: "close", wantErr: true, wantContent: original},
+		{name: "rename fails", failAt: "rename", wantErr: true, wantContent: original},
+		{name: "syncing dir fails after rename", failAt: "sync_dir", wantErr: true, wantContent: updated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "sshd_config")
+			if err := os.WriteFile(path, []byte(original), 0o600); err != nil {
+				t.Fatalf("could not write original file: %v", err)
+			}
+
+			fsys := &faultyFileSystem{failAt: tt.failAt}
+			if err := writeFileAtomic(fsys, path, []byte(updated), 0o644); (err != nil) != tt.wantErr {
+				t.Errorf("writeFileAtomic() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("could not read file: %v", err)
+			}
+			if string(content) != tt.wantContent {
+				t.Errorf("writeFileAtomic() content = %q, want %q", content, tt.wantContent)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("could not stat file: %v", err)
+			}
+			if info.Mode().Perm() != 0o600 {
+				t.Errorf("writeFileAtomic() mode = %v, want %v", info.Mode().Perm(), os.FileMode(0o600))
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("could not read dir: %v", err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("writeFileAtomic() left temporary files behind: %v", entries)
+			}
+		})
+	}
+}
+
+func Test_writeFileAtomic_symlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "store", "sshd_config")
+	writeTestFile(t, target, "Port 22\n")
+	link := filepath.Join(dir, "sshd_config")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(osFileSystem{}, link, []byte("Port 2222\n"), 0o600); err != nil {
+		t.Fatalf("writeFileAtomic() error = %v", err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("writeFileAtomic() replaced symlink with %v", info.Mode())
+	}
+
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "Port 2222\n" {
+		t.Errorf("writeFileAtomic() target = %q, want %q", data, "Port 2222\n")
+	}
+}
+
+func Test_writeFileAtomic_newFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sshd_config")
+	if err := writeFileAtomic(osFileSystem{}, path, []byte("Port 22\n"), 0o640); err != nil {
+		t.Fatalf("writeFileAtomic() error = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("could not stat file: %v", err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("writeFileAtomic() mode = %v, want %v", info.Mode().Perm(), os.FileMode(0o640))
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+const (
+	// sourcesPolicyAny reports up if at least one source is up
+	sourcesPolicyAny = "any"
+	// sourcesPolicyAll reports up only if all sources are up
+	sourcesPolicyAll = "all"
+	// sourcesPolicyQuorumPrefix reports up if at least n sources are up, written as quorum(n)
+	sourcesPolicyQuorumPrefix = "quorum("
+)
+
+// namedStatusSource is a TunnelStatusSource identified by a name used in logs and metrics.
+type namedStatusSource struct {
+	name   string
+	source TunnelStatusSource
+}
+
+// CompositeStatus combines the status of multiple sources. It reports up if at least a quorum of sources is up and
+// down if the quorum can not be reached anymore, even if all unknown sources turned out to be up. Otherwise, the
+// status is unknown.
+type CompositeStatus struct {
+	sources []namedStatusSource
+	quorum  int
+	last    map[string]TunnelStatus
+}
+
+func NewCompositeStatus(sources []namedStatusSource, quorum int) (*CompositeStatus, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("no sources provided")
+	}
+
+	if quorum < 1 || quorum > len(sources) {
+		return nil, fmt.Errorf("quorum must be between 1 and %d", len(sources))
+	}
+
+	for _, source := range sources {
+		if source.source == nil {
+			return nil, fmt.Errorf("no implementation provided for source %q", source.name)
+		}
+	}
+
+	return &CompositeStatus{
+		sources: sources,
+		quorum:  quorum,
+		last:    map[string]TunnelStatus{},
+	}, nil
+}
+
+func (c *CompositeStatus) GetStatus() TunnelStatus {
+	statuses := make(map[string]TunnelStatus, len(c.sources))
+	for _, source := range c.sources {
+		status := source.source.GetStatus()
+		statuses[source.name] = status
+
+		if last, found := c.last[source.name]; !found || last != status {
+			slog.Info("Source status changed", "source", source.name, "from", last, "to", status)
+		} else {
+			slog.Debug("Read source status", "source", source.name, "status", status)
+		}
+	}
+
+	c.last = statuses
+	metrics.SourceStatus = statuses
+	return c.evaluate(statuses)
+}
+
+func (c *CompositeStatus) SourceStatuses() map[string]TunnelStatus {
+	return c.last
+}
+
+// SetInterfaceAddresses replaces the addresses required by the interface source with the given name.
+func (c *CompositeStatus) SetInterfaceAddresses(name string, addresses []string) error {
+	for _, source := range c.sources {
+		if source.name != name {
+			continue
+		}
+
+		iface, ok := source.source.(*InterfaceStatus)
+		if !ok {
+			return fmt.Errorf("source %q is not an interface source", name)
+		}
+		return iface.SetAddresses(addresses)
+	}
+
+	return fmt.Errorf("no source %q", name)
+}
+
+func (c *CompositeStatus) evaluate(statuses map[string]TunnelStatus) TunnelStatus {
+	up, unknown := 0, 0
+	for _, status := range statuses {
+		switch status {
+		case Up:
+			up++
+		case Unknown:
+			unknown++
+		case Down:
+		}
+	}
+
+	if up >= c.quorum {
+		return Up
+	}
+	if up+unknown < c.quorum {
+		return Down
+	}
+	return Unknown
+}
+
+// parseSourcesPolicy returns the number of sources required to be up for the given policy.
+func parseSourcesPolicy(policy string, numSources int) (int, error) {
+	var quorum int
+	switch {
+	case policy == sourcesPolicyAny:
+		quorum = 1
+	case policy == sourcesPolicyAll:
+		quorum = numSources
+	case strings.HasPrefix(policy, sourcesPolicyQuorumPrefix) && strings.HasSuffix(policy, ")"):
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(policy, sourcesPolicyQuorumPrefix), ")"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid quorum in sources policy %q: %w", policy, err)
+		}
+		quorum = n
+	default:
+		return 0, fmt.Errorf("invalid sources policy %q, must be one of %s, %s or quorum(n)", policy, sourcesPolicyAny, sourcesPolicyAll)
+	}
+
+	if quorum < 1 || quorum > numSources {
+		return 0, fmt.Errorf("quorum of sources policy %q must be between 1 and the number of sources (%d)", policy, numSources)
+	}
+
+	return quorum, nil
+}
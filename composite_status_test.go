@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCompositeStatus_GetStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []TunnelStatus
+		quorum   int
+		want     TunnelStatus
+	}{
+		{
+			name:     "any, one up",
+			statuses: []TunnelStatus{Down, Up},
+			quorum:   1,
+			want:     Up,
+		},
+		{
+			name:     "any, none up",
+			statuses: []TunnelStatus{Down, Down},
+			quorum:   1,
+			want:     Down,
+		},
+		{
+			name:     "any, none up, one unknown",
+			statuses: []TunnelStatus{Down, Unknown},
+			quorum:   1,
+			want:     Unknown,
+		},
+		{
+			name:     "all, all up",
+			statuses: []TunnelStatus{Up, Up},
+			quorum:   2,
+			want:     Up,
+		},
+		{
+			name:     "all, one down",
+			statuses: []TunnelStatus{Up, Down},
+			quorum:   2,
+			want:     Down,
+		},
+		{
+			name:     "all, one unknown",
+			statuses: []TunnelStatus{Up, Unknown},
+			quorum:   2,
+			want:     Unknown,
+		},
+		{
+			name:     "quorum reached",
+			statuses: []TunnelStatus{Up, Down, Up},
+			quorum:   2,
+			want:     Up,
+		},
+		{
+			name:     "quorum not reachable",
+			statuses: []TunnelStatus{Up, Down, Down},
+			quorum:   2,
+			want:     Down,
+		},
+		{
+			name:     "quorum reachable",
+			statuses: []TunnelStatus{Up, Down, Unknown},
+			quorum:   2,
+			want:     Unknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sources []namedStatusSource
+			names := []string{"wg0", "wg1", "wg2"}
+			for idx, status := range tt.statuses {
+				sources = append(sources, namedStatusSource{name: names[idx], source: &dummyStatusSource{status: status}})
+			}
+
+			c, err := NewCompositeStatus(sources, tt.quorum)
+			if err != nil {
+				t.Fatalf("NewCompositeStatus() error = %v", err)
+			}
+			if got := c.GetStatus(); got != tt.want {
+				t.Errorf("GetStatus() = %v, want %v", got, tt.want)
+			}
+			for idx, status := range tt.statuses {
+				if metrics.SourceStatus[names[idx]] != status {
+					t.Errorf("GetStatus() metric for %s = %v, want %v", names[idx], metrics.SourceStatus[names[idx]], status)
+				}
+			}
+		})
+	}
+}
+
+func Test_parseSourcesPolicy(t *testing.T) {
+	tests := []struct {
+		policy     string
+		numSources int
+		want       int
+		wantErr    bool
+	}{
+		{policy: "any", numSources: 3, want: 1},
+		{policy: "all", numSources: 3, want: 3},
+		{policy: "quorum(2)", numSources: 3, want: 2},
+		{policy: "quorum(3)", numSources: 3, want: 3},
+		{policy: "quorum(4)", numSources: 3, wantErr: true},
+		{policy: "quorum(0)", numSources: 3, wantErr: true},
+		{policy: "quorum(x)", numSources: 3, wantErr: true},
+		{policy: "quorum(2", numSources: 3, wantErr: true},
+		{policy: "most", numSources: 3, wantErr: true},
+		{policy: "", numSources: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			got, err := parseSourcesPolicy(tt.policy, tt.numSources)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseSourcesPolicy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseSourcesPolicy() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
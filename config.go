@@ -1,34 +1,323 @@
 package main
 
 import (
+	"cmp"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
 	"slices"
+	"time"
 )
 
 const (
 	configDefaultMetricsFile        = "/var/lib/node_exporter/ssh_aegis.prom"
 	configDefaultSshServiceName     = "sshd"
 	configDefaultWireguardInterface = "wg0"
+	configDefaultWireguardBackend   = wgBackendCli
 	configDefaultSshdConfigFile     = "/etc/ssh/sshd_config"
+	configDefaultSshdBinary         = "/usr/sbin/sshd"
+	configDefaultSshdConfigMode     = sshdConfigModeMain
+	configDefaultSshdDropInFile     = "/etc/ssh/sshd_config.d/00-ssh-aegis.conf"
+	configDefaultCheckInterval      = 60
+	configDefaultStateFile          = "/var/lib/ssh-aegis/state.json"
+	// wireguard discards session keys after 180s without a handshake, see REJECT_AFTER_TIME in the whitepaper
+	configDefaultWireguardMaxHandshakeAge = 180
+
+	configDefaultSourcesPolicy = sourcesPolicyAny
+
+	configDefaultProbeTimeout      = 2
+	configDefaultProbeMinSuccesses = 1
+	configDefaultExecTimeout       = 10
+	configDefaultExecMatch         = execMatchExitCode
+	configDefaultVerifyRetries     = 5
+	configDefaultDriftMode         = driftModeAlert
+	configDefaultNftBinary         = "/usr/sbin/nft"
+
+	// sourceTypeWireguard determines the status using the handshakes of wireguard peers
+	sourceTypeWireguard = "wireguard"
+	// sourceTypeProbe determines the status by probing targets through the tunnel
+	sourceTypeProbe = "probe"
+	// sourceTypeExec determines the status by running a command
+	sourceTypeExec = "exec"
+	// sourceTypeInterface determines the status using the state and addresses of a network interface
+	sourceTypeInterface = "interface"
+
+	// sshdConfigModeMain edits the ListenAddress directives of the main sshd config in place
+	sshdConfigModeMain = "main"
+	// sshdConfigModeDropIn manages ListenAddress directives in a dedicated drop-in file
+	sshdConfigModeDropIn = "dropin"
+
+	// driftModeRepair rewrites the ListenAddress directives if they differ from the wanted addresses
+	driftModeRepair = "repair"
+	// driftModeAlert only reports ListenAddress directives that differ from the wanted addresses
+	driftModeAlert = "alert"
+	// driftModeIgnore does not check the ListenAddress directives while the status stays the same
+	driftModeIgnore = "ignore"
+
+	// firewallNftables restricts access to ssh using a dedicated nftables table
+	firewallNftables = "nftables"
 )
 
 type SshAegisConfig struct {
-	ListenAddressesUp      []string `json:"up"`
-	ListenAddressesDown    []string `json:"down"`
-	ListenAddressesUnknown []string `json:"unknown,omitempty"`
-	SshdConfigFile         string   `json:"sshd_config_file,omitempty"`
-	WireguardInterface     string   `json:"wg,omitempty"`
-	SshServiceName         string   `json:"ssh_service_name"`
-	MetricsFile            string   `json:"metrics_file"`
+	ListenAddressesUp               []string                       `json:"up"`
+	ListenAddressesDown             []string                       `json:"down"`
+	ListenAddressesUnknown          []string                       `json:"unknown,omitempty"`
+	ListenAddressesShutdown         []string                       `json:"shutdown,omitempty"`
+	SshdConfigFile                  string                         `json:"sshd_config_file,omitempty"`
+	SshdBinary                      string                         `json:"sshd_binary"`
+	SshdConfigMode                  string                         `json:"sshd_config_mode,omitempty"`
+	SshdDropInFile                  string                         `json:"sshd_dropin_file,omitempty"`
+	WireguardInterface              string                         `json:"wg,omitempty"`
+	WireguardBackend                string                         `json:"wg_backend,omitempty"`
+	WireguardPeers                  []string                       `json:"wg_peers,omitempty"`
+	WireguardMaxHandshakeAgeSeconds int                            `json:"wg_max_handshake_age_seconds,omitempty"`
+	SshServiceName                  string                         `json:"ssh_service_name"`
+	CheckIntervalSeconds            int                            `json:"check_interval_seconds,omitempty"`
+	NetlinkEvents                   bool                           `json:"netlink_events"`
+	MetricsFile                     string                         `json:"metrics_file"`
+	StateFile                       string                         `json:"state_file"`
+	MetricsListenAddress            string                         `json:"metrics_listen_address,omitempty"`
+	Transitions                     map[string]TransitionThreshold `json:"transitions,omitempty"`
+	Sources                         []SourceConfig                 `json:"sources,omitempty"`
+	SourcesPolicy                   string                         `json:"sources_policy,omitempty"`
+	Rules                           []AddressRule                  `json:"rules,omitempty"`
+	VerifyListenAddresses           bool                           `json:"verify_listen_addresses"`
+	VerifyListenRetries             int                            `json:"verify_listen_retries,omitempty"`
+	DriftMode                       string                         `json:"drift_mode,omitempty"`
+	RestoreOnExit                   bool                           `json:"restore_on_exit"`
+	LockoutTimeoutSeconds           int                            `json:"lockout_timeout_seconds,omitempty"`
+	LockoutProbeTargets             []string                       `json:"lockout_probe_targets,omitempty"`
+	LockoutConfirmFile              string                         `json:"lockout_confirm_file,omitempty"`
+	Firewall                        string                         `json:"firewall,omitempty"`
+	FirewallAllowedSources          []string                       `json:"firewall_allowed_sources,omitempty"`
+	NftBinary                       string                         `json:"nft_binary,omitempty"`
+}
+
+// SourceConfig configures a single status source. If no sources are configured, the top-level wg settings are used
+// as a single wireguard source. Unset backend and max handshake age settings default to the top-level settings.
+type SourceConfig struct {
+	Name                            string            `json:"name,omitempty"`
+	Type                            string            `json:"type"`
+	WireguardInterface              string            `json:"wg,omitempty"`
+	WireguardBackend                string            `json:"wg_backend,omitempty"`
+	WireguardPeers                  []string          `json:"wg_peers,omitempty"`
+	WireguardMaxHandshakeAgeSeconds int               `json:"wg_max_handshake_age_seconds,omitempty"`
+	ProbeTargets                    []string          `json:"probe_targets,omitempty"`
+	ProbeTimeoutSeconds             int               `json:"probe_timeout_seconds,omitempty"`
+	ProbeRetries                    int               `json:"probe_retries,omitempty"`
+	ProbeMinSuccesses               int               `json:"probe_min_successes,omitempty"`
+	ExecCommand                     []string          `json:"exec_command,omitempty"`
+	ExecTimeoutSeconds              int               `json:"exec_timeout_seconds,omitempty"`
+	ExecMatch                       string            `json:"exec_match,omitempty"`
+	ExecMapping                     map[string]string `json:"exec_mapping,omitempty"`
+	Interface                       string            `json:"interface,omitempty"`
+	InterfaceAddresses              []string          `json:"interface_addresses,omitempty"`
+}
+
+var (
+	sourceTypes       = []string{sourceTypeWireguard, sourceTypeProbe, sourceTypeExec, sourceTypeInterface}
+	driftModes        = []string{driftModeRepair, driftModeAlert, driftModeIgnore}
+	sourceNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.:-]+$`)
+)
+
+func (s *SourceConfig) Validate() error { //nolint:cyclop
+	switch s.Type {
+	case sourceTypeWireguard:
+		if s.WireguardInterface == "" {
+			return errors.New("empty wg interface name provided")
+		}
+
+		if !slices.Contains(wgBackends, s.WireguardBackend) {
+			return fmt.Errorf("invalid wg backend %q, must be one of %v", s.WireguardBackend, wgBackends)
+		}
+
+		if s.WireguardMaxHandshakeAgeSeconds <= 0 {
+			return errors.New("wg max handshake age must be positive")
+		}
+
+		for _, peer := range s.WireguardPeers {
+			if !isValidWgKey(peer) {
+				return fmt.Errorf("invalid wg peer public key supplied: %s", peer)
+			}
+		}
+	case sourceTypeProbe:
+		if len(s.ProbeTargets) == 0 {
+			return errors.New("no probe targets provided")
+		}
+
+		for _, target := range s.ProbeTargets {
+			if _, err := parseProbeTarget(target); err != nil {
+				return err
+			}
+		}
+
+		if s.ProbeTimeoutSeconds <= 0 {
+			return errors.New("probe timeout must be positive")
+		}
+
+		if s.ProbeRetries < 0 {
+			return errors.New("probe retries must not be negative")
+		}
+
+		if s.ProbeMinSuccesses < 1 || s.ProbeMinSuccesses > len(s.ProbeTargets) {
+			return fmt.Errorf("probe min successes must be between 1 and the number of targets (%d)", len(s.ProbeTargets))
+		}
+	case sourceTypeExec:
+		if len(s.ExecCommand) == 0 || s.ExecCommand[0] == "" {
+			return errors.New("no exec command provided")
+		}
+
+		if _, err := exec.LookPath(s.ExecCommand[0]); err != nil {
+			return fmt.Errorf("exec command not found: %w", err)
+		}
+
+		if s.ExecTimeoutSeconds <= 0 {
+			return errors.New("exec timeout must be positive")
+		}
+
+		if _, err := parseExecMapping(s.ExecMatch, s.ExecMapping); err != nil {
+			return err
+		}
+	case sourceTypeInterface:
+		if s.Interface == "" {
+			return errors.New("empty interface name provided")
+		}
+
+		for _, addr := range s.InterfaceAddresses {
+			if net.ParseIP(addr) == nil {
+				return fmt.Errorf("invalid interface address supplied: %s", addr)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid source type %q, must be one of %v", s.Type, sourceTypes)
+	}
+
+	if !sourceNamePattern.MatchString(s.Name) {
+		return fmt.Errorf("invalid source name %q, must only contain letters, digits, '_', '.', ':' and '-'", s.Name)
+	}
+
+	return nil
 }
 
 func (c *SshAegisConfig) Validate() error { //nolint:cyclop
-	if slices.Equal(c.ListenAddressesUp, c.ListenAddressesDown) {
+	if len(c.Rules) > 0 {
+		// 'down' is not checked, as it has a default value
+		if len(c.ListenAddressesUp) > 0 || len(c.ListenAddressesUnknown) > 0 {
+			return errors.New("addresses for 'up' and 'unknown' can not be combined with rules")
+		}
+	} else if err := c.validateLegacyAddresses(); err != nil {
+		return err
+	}
+
+	_, err := os.Stat(c.SshdConfigFile)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("sshd config file does not exist: %s", c.SshdConfigFile)
+	}
+
+	switch c.SshdConfigMode {
+	case sshdConfigModeMain:
+	case sshdConfigModeDropIn:
+		if c.SshdDropInFile == "" {
+			return errors.New("empty sshd drop-in file provided")
+		}
+		if !filepath.IsAbs(c.SshdDropInFile) {
+			return fmt.Errorf("sshd drop-in file must be an absolute path: %s", c.SshdDropInFile)
+		}
+	default:
+		return fmt.Errorf("invalid sshd config mode %q, must be one of %v", c.SshdConfigMode, []string{sshdConfigModeMain, sshdConfigModeDropIn})
+	}
+
+	// a missing default binary only disables validation, see buildConfigWrapper
+	if c.SshdBinary != "" && c.SshdBinary != configDefaultSshdBinary {
+		if _, err := exec.LookPath(c.SshdBinary); err != nil {
+			return fmt.Errorf("sshd binary for validating configs not found: %w", err)
+		}
+	}
+
+	if c.SshServiceName == "" {
+		return errors.New("empty ssh service name provided")
+	}
+
+	if c.MetricsListenAddress != "" {
+		if _, _, err := net.SplitHostPort(c.MetricsListenAddress); err != nil {
+			return fmt.Errorf("invalid metrics listen address %q: %w", c.MetricsListenAddress, err)
+		}
+	}
+
+	if c.VerifyListenRetries < 0 {
+		return errors.New("verify listen retries must not be negative")
+	}
+
+	if !slices.Contains(driftModes, c.DriftMode) {
+		return fmt.Errorf("invalid drift mode %q, must be one of %v", c.DriftMode, driftModes)
+	}
+
+	if len(c.ListenAddressesShutdown) > 0 && !c.RestoreOnExit {
+		return errors.New("addresses for shutdown require restore_on_exit to be enabled")
+	}
+
+	for _, addr := range c.ListenAddressesShutdown {
+		if _, err := ParseListenAddress(addr); err != nil {
+			return fmt.Errorf("invalid shutdown address supplied: %s: %w", addr, err)
+		}
+	}
+
+	if c.CheckIntervalSeconds <= 0 {
+		return errors.New("check interval must be positive")
+	}
+
+	if err := c.validateLockout(); err != nil {
+		return err
+	}
+
+	if err := c.validateFirewall(); err != nil {
+		return err
+	}
+
+	for status, threshold := range c.Transitions {
+		if _, found := parseTunnelStatus(status); !found {
+			return fmt.Errorf("invalid status %q for transition threshold", status)
+		}
+		if threshold.MinReadings < 0 || threshold.StableSeconds < 0 {
+			return fmt.Errorf("negative transition threshold for status %q", status)
+		}
+	}
+
+	sources := c.sources()
+	names := map[string]bool{}
+	for idx, source := range sources {
+		if err := source.Validate(); err != nil {
+			return fmt.Errorf("invalid source #%d: %w", idx+1, err)
+		}
+		if names[source.Name] {
+			return fmt.Errorf("duplicate source name %q", source.Name)
+		}
+		names[source.Name] = true
+
+		if source.Type == sourceTypeInterface && source.InterfaceAddresses == nil && len(c.Rules) == 0 && c.interfaceSources() > 1 {
+			return fmt.Errorf("invalid source #%d: interface addresses must be set if there are multiple interface sources", idx+1)
+		}
+	}
+
+	if _, err := parseSourcesPolicy(c.SourcesPolicy, len(sources)); err != nil {
+		return err
+	}
+
+	if _, err := c.addressRules(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *SshAegisConfig) validateLegacyAddresses() error {
+	if slices.Equal(normalizeListenAddresses(c.ListenAddressesUp), normalizeListenAddresses(c.ListenAddressesDown)) {
 		return errors.New("addresses for up and down are equal")
 	}
 
@@ -40,39 +329,286 @@ func (c *SshAegisConfig) Validate() error { //nolint:cyclop
 		return errors.New("no addresses configured for tunnel status 'down'")
 	}
 
-	for _, addr := range append(c.ListenAddressesUp, c.ListenAddressesDown...) {
-		if net.ParseIP(addr) == nil {
-			return fmt.Errorf("invalid address supplied: %s", addr)
+	for _, addr := range slices.Concat(c.ListenAddressesUp, c.ListenAddressesDown, c.ListenAddressesUnknown) {
+		if _, err := ParseListenAddress(addr); err != nil {
+			return fmt.Errorf("invalid address supplied: %s: %w", addr, err)
 		}
 	}
 
-	if len(c.ListenAddressesUnknown) > 0 {
-		for _, addr := range c.ListenAddressesUnknown {
-			if net.ParseIP(addr) == nil {
-				return fmt.Errorf("invalid address supplied: %s", addr)
-			}
+	return nil
+}
+
+func (c *SshAegisConfig) validateLockout() error {
+	if c.LockoutTimeoutSeconds < 0 {
+		return errors.New("lockout timeout must not be negative")
+	}
+
+	if c.LockoutTimeoutSeconds == 0 {
+		if len(c.LockoutProbeTargets) > 0 || c.LockoutConfirmFile != "" {
+			return errors.New("lockout probe targets and confirm file require lockout_timeout_seconds")
 		}
+		return nil
 	}
 
-	_, err := os.Stat(c.SshdConfigFile)
-	if os.IsNotExist(err) {
-		return fmt.Errorf("sshd config file does not exist: %s", c.SshdConfigFile)
+	for _, target := range c.LockoutProbeTargets {
+		if _, err := parseProbeTarget(target); err != nil {
+			return fmt.Errorf("invalid lockout probe target: %w", err)
+		}
 	}
 
-	if c.SshServiceName == "" {
-		return errors.New("empty ssh service name provided")
+	if c.LockoutConfirmFile != "" && !filepath.IsAbs(c.LockoutConfirmFile) {
+		return fmt.Errorf("lockout confirm file must be an absolute path: %s", c.LockoutConfirmFile)
+	}
+
+	return nil
+}
+
+func (c *SshAegisConfig) validateFirewall() error {
+	switch c.Firewall {
+	case "":
+		if len(c.FirewallAllowedSources) > 0 {
+			return errors.New("firewall allowed sources require a firewall")
+		}
+		return nil
+	case firewallNftables:
+		if _, err := exec.LookPath(c.NftBinary); err != nil {
+			return fmt.Errorf("nft binary not found: %w", err)
+		}
+	default:
+		return fmt.Errorf("invalid firewall %q, must be one of %v", c.Firewall, []string{firewallNftables})
+	}
+
+	if len(c.FirewallAllowedSources) == 0 {
+		return errors.New("no firewall allowed sources configured")
 	}
 
-	if c.WireguardInterface == "" {
-		return errors.New("empty wg interface name provided")
+	for _, source := range c.FirewallAllowedSources {
+		if err := validateAllowedSource(source); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// addressRules returns the configured rules. If no rules are configured, the addresses configured for up, down and
+// unknown are converted to rules.
+func (c *SshAegisConfig) addressRules() (addressRules, error) {
+	if len(c.Rules) == 0 {
+		return newLegacyAddressRules(c.ListenAddressesUp, c.ListenAddressesDown, c.ListenAddressesUnknown), nil
+	}
+
+	var sourceNames []string
+	for _, source := range c.sources() {
+		sourceNames = append(sourceNames, source.Name)
+	}
+
+	rules, err := compileAddressRules(c.Rules, sourceNames)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rules.verifyExhaustive(sourceNames); err != nil {
+		return nil, err
+	}
+
+	// falling back after a listen mismatch or a lockout must not silently be disabled
+	if len(rules.fallbackAddresses()) == 0 {
+		return nil, errors.New("no addresses to fall back to, the first rule matching status 'down' with all sources unknown must have addresses")
+	}
+
+	return rules, nil
+}
+
+func (s *SourceConfig) printConfig() {
+	switch s.Type {
+	case sourceTypeWireguard:
+		slog.Info("Using config", "source", s.Name, "type", s.Type, "wg_interface", s.WireguardInterface,
+			"wg_backend", s.WireguardBackend, "wg_max_handshake_age", time.Duration(s.WireguardMaxHandshakeAgeSeconds)*time.Second,
+			"wg_peers", s.WireguardPeers)
+	case sourceTypeProbe:
+		slog.Info("Using config", "source", s.Name, "type", s.Type, "probe_targets", s.ProbeTargets,
+			"probe_timeout", time.Duration(s.ProbeTimeoutSeconds)*time.Second, "probe_retries", s.ProbeRetries,
+			"probe_min_successes", s.ProbeMinSuccesses)
+	case sourceTypeExec:
+		mapping := s.ExecMapping
+		if len(mapping) == 0 {
+			mapping = defaultExecMappings[s.ExecMatch]
+		}
+		slog.Info("Using config", "source", s.Name, "type", s.Type, "exec_command", s.ExecCommand,
+			"exec_timeout", time.Duration(s.ExecTimeoutSeconds)*time.Second, "exec_match", s.ExecMatch,
+			"exec_mapping", mapping)
+	case sourceTypeInterface:
+		slog.Info("Using config", "source", s.Name, "type", s.Type, "interface", s.Interface,
+			"interface_addresses", s.InterfaceAddresses)
+	}
+}
+
+// sourceSettings are the settings the status sources are built from.
+type sourceSettings struct {
+	Sources                         []SourceConfig
+	SourcesPolicy                   string
+	WireguardInterface              string
+	WireguardPeers                  []string
+	WireguardBackend                string
+	WireguardMaxHandshakeAgeSeconds int
+}
+
+func (c *SshAegisConfig) sourceSettings() sourceSettings {
+	return sourceSettings{
+		Sources:                         c.Sources,
+		SourcesPolicy:                   c.SourcesPolicy,
+		WireguardInterface:              c.WireguardInterface,
+		WireguardPeers:                  c.WireguardPeers,
+		WireguardBackend:                c.WireguardBackend,
+		WireguardMaxHandshakeAgeSeconds: c.WireguardMaxHandshakeAgeSeconds,
+	}
+}
+
+// sources returns the configured sources with defaults applied. If no sources are configured, a single wireguard
+// source built from the top-level wg settings is returned.
+func (c *SshAegisConfig) sources() []SourceConfig {
+	sources := slices.Clone(c.Sources)
+	if len(sources) == 0 {
+		sources = []SourceConfig{{
+			Type:               sourceTypeWireguard,
+			WireguardInterface: c.WireguardInterface,
+			WireguardPeers:     c.WireguardPeers,
+		}}
+	}
+
+	for idx := range sources {
+		source := &sources[idx]
+		switch source.Type {
+		case sourceTypeWireguard:
+			source.Name = cmp.Or(source.Name, source.WireguardInterface)
+			source.WireguardBackend = cmp.Or(source.WireguardBackend, c.WireguardBackend)
+			source.WireguardMaxHandshakeAgeSeconds = cmp.Or(source.WireguardMaxHandshakeAgeSeconds, c.WireguardMaxHandshakeAgeSeconds)
+		case sourceTypeProbe:
+			source.ProbeTimeoutSeconds = cmp.Or(source.ProbeTimeoutSeconds, configDefaultProbeTimeout)
+			source.ProbeMinSuccesses = cmp.Or(source.ProbeMinSuccesses, configDefaultProbeMinSuccesses)
+		case sourceTypeExec:
+			source.ExecTimeoutSeconds = cmp.Or(source.ExecTimeoutSeconds, configDefaultExecTimeout)
+			source.ExecMatch = cmp.Or(source.ExecMatch, configDefaultExecMatch)
+		case sourceTypeInterface:
+			source.Name = cmp.Or(source.Name, source.Interface)
+			// an explicitly configured empty list disables checking addresses. The addresses for status 'up' are only
+			// known to be assigned to the interface if there is no other interface source.
+			if source.InterfaceAddresses == nil && len(c.Rules) == 0 && c.interfaceSources() == 1 {
+				source.InterfaceAddresses = c.upHosts()
+			}
+		}
+		source.Name = cmp.Or(source.Name, source.Type)
+	}
+
+	return sources
+}
+
+// interfaceSources returns the number of configured sources of type interface.
+func (c *SshAegisConfig) interfaceSources() int {
+	count := 0
+	for _, source := range c.Sources {
+		if source.Type == sourceTypeInterface {
+			count++
+		}
+	}
+
+	return count
+}
+
+// upHosts returns the specific hosts of the addresses configured for status 'up'.
+func (c *SshAegisConfig) upHosts() []string {
+	var hosts []string
+	for _, addr := range c.ListenAddressesUp {
+		parsed, err := ParseListenAddress(addr)
+		if err != nil || parsed.Host.IsUnspecified() || slices.Contains(hosts, parsed.Host.String()) {
+			continue
+		}
+		hosts = append(hosts, parsed.Host.String())
+	}
+
+	return hosts
+}
+
+// watchedInterfaces returns the network interfaces whose changes affect the status of the configured sources.
+func (c *SshAegisConfig) watchedInterfaces() []string {
+	var interfaces []string
+	for _, source := range c.sources() {
+		var iface string
+		switch source.Type {
+		case sourceTypeWireguard:
+			iface = source.WireguardInterface
+		case sourceTypeInterface:
+			iface = source.Interface
+		}
+
+		if iface != "" && !slices.Contains(interfaces, iface) {
+			interfaces = append(interfaces, iface)
+		}
+	}
+
+	return interfaces
+}
+
 func (c *SshAegisConfig) printConfig() {
-	slog.Info("Using config", "wg_interface", c.WireguardInterface)
+	sources := c.sources()
+	for _, source := range sources {
+		source.printConfig()
+	}
+	if len(sources) > 1 {
+		slog.Info("Using config", "sources_policy", c.SourcesPolicy)
+	}
 	slog.Info("Using config", "sshd_config", c.SshdConfigFile)
+	slog.Info("Using config", "sshd_config_mode", c.SshdConfigMode)
+	if c.SshdConfigMode == sshdConfigModeDropIn {
+		slog.Info("Using config", "sshd_dropin_file", c.SshdDropInFile)
+	}
+	slog.Info("Using config", "ssh_service_name", c.SshServiceName)
+	if c.SshdBinary == "" {
+		slog.Warn("Validating sshd configs before restarting ssh is disabled")
+	} else {
+		slog.Info("Using config", "sshd_binary", c.SshdBinary)
+	}
+	if c.StateFile != "" {
+		slog.Info("Using config", "state_file", c.StateFile)
+	}
+	if c.MetricsListenAddress != "" {
+		slog.Info("Using config", "metrics_listen_address", c.MetricsListenAddress)
+	}
+	slog.Info("Using config", "check_interval", time.Duration(c.CheckIntervalSeconds)*time.Second)
+	slog.Info("Using config", "netlink_events", c.NetlinkEvents)
+	slog.Info("Using config", "verify_listen_addresses", c.VerifyListenAddresses)
+	if c.VerifyListenAddresses {
+		slog.Info("Using config", "verify_listen_retries", c.VerifyListenRetries)
+	}
+	slog.Info("Using config", "drift_mode", c.DriftMode)
+	if c.Firewall != "" {
+		slog.Info("Using config", "firewall", c.Firewall)
+		slog.Info("Using config", "firewall_allowed_sources", c.FirewallAllowedSources)
+		slog.Info("Using config", "nft_binary", c.NftBinary)
+	}
+	slog.Info("Using config", "restore_on_exit", c.RestoreOnExit)
+	if c.LockoutTimeoutSeconds > 0 {
+		slog.Info("Using config", "lockout_timeout", time.Duration(c.LockoutTimeoutSeconds)*time.Second)
+		if len(c.LockoutProbeTargets) > 0 {
+			slog.Info("Using config", "lockout_probe_targets", c.LockoutProbeTargets)
+		}
+		if c.LockoutConfirmFile != "" {
+			slog.Info("Using config", "lockout_confirm_file", c.LockoutConfirmFile)
+		}
+	}
+	if len(c.ListenAddressesShutdown) > 0 {
+		slog.Info("Using config", "status", "shutdown", "addresses", c.ListenAddressesShutdown)
+	}
+	for status, threshold := range c.Transitions {
+		slog.Info("Using config", "transition_to", status, "min_readings", threshold.MinReadings, "stable_for", time.Duration(threshold.StableSeconds)*time.Second)
+	}
+	if len(c.Rules) > 0 {
+		for idx, rule := range c.Rules {
+			slog.Info("Using config", "rule", idx+1, "status", rule.Status, "sources", rule.Sources, "addresses", rule.Addresses)
+		}
+		return
+	}
 	slog.Info("Using config", "status", "up", "addresses", c.ListenAddressesUp)
 	slog.Info("Using config", "status", "down", "addresses", c.ListenAddressesDown)
 	if len(c.ListenAddressesUnknown) > 0 {
@@ -80,13 +616,46 @@ func (c *SshAegisConfig) printConfig() {
 	}
 }
 
+// managedConfigFile returns the sshd config file containing the ListenAddress directives managed by ssh-aegis.
+func (c *SshAegisConfig) managedConfigFile() string {
+	if c.SshdConfigMode == sshdConfigModeDropIn {
+		return c.SshdDropInFile
+	}
+
+	return c.SshdConfigFile
+}
+
+func (c *SshAegisConfig) transitionThresholds() map[TunnelStatus]TransitionThreshold {
+	ret := map[TunnelStatus]TransitionThreshold{}
+	for status, threshold := range c.Transitions {
+		if parsed, found := parseTunnelStatus(status); found {
+			ret[parsed] = threshold
+		}
+	}
+
+	return ret
+}
+
 func getDefault() SshAegisConfig {
 	return SshAegisConfig{
-		ListenAddressesDown: []string{"0.0.0.0"},
-		SshdConfigFile:      configDefaultSshdConfigFile,
-		WireguardInterface:  configDefaultWireguardInterface,
-		SshServiceName:      configDefaultSshServiceName,
-		MetricsFile:         configDefaultMetricsFile,
+		ListenAddressesDown:             []string{"0.0.0.0"},
+		SshdConfigFile:                  configDefaultSshdConfigFile,
+		SshdBinary:                      configDefaultSshdBinary,
+		SshdConfigMode:                  configDefaultSshdConfigMode,
+		SshdDropInFile:                  configDefaultSshdDropInFile,
+		WireguardInterface:              configDefaultWireguardInterface,
+		WireguardBackend:                configDefaultWireguardBackend,
+		WireguardMaxHandshakeAgeSeconds: configDefaultWireguardMaxHandshakeAge,
+		SshServiceName:                  configDefaultSshServiceName,
+		MetricsFile:                     configDefaultMetricsFile,
+		StateFile:                       configDefaultStateFile,
+		CheckIntervalSeconds:            configDefaultCheckInterval,
+		NetlinkEvents:                   true,
+		SourcesPolicy:                   configDefaultSourcesPolicy,
+		VerifyListenAddresses:           true,
+		VerifyListenRetries:             configDefaultVerifyRetries,
+		DriftMode:                       configDefaultDriftMode,
+		NftBinary:                       configDefaultNftBinary,
 	}
 }
 
@@ -1,6 +1,9 @@
 package main
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 var (
 	testValidAddressesMixed []string = []string{"0.0.0.0", "::"}
@@ -18,6 +21,8 @@ func TestSshAegisConfig_Validate(t *testing.T) {
 		ListenAddressesUnknown []string
 		SshdConfigFile         string
 		WireguardInterface     string
+		WireguardPeers         []string
+		WireguardMaxAge        int
 		SshServiceName         string
 		MetricsFile            string
 	}
@@ -34,6 +39,7 @@ func TestSshAegisConfig_Validate(t *testing.T) {
 				ListenAddressesUnknown: nil,
 				SshdConfigFile:         validSshConfigFile,
 				WireguardInterface:     "wg0",
+				WireguardMaxAge:        180,
 				SshServiceName:         "ssh",
 				MetricsFile:            "contrib/configs/test.prom",
 			},
@@ -47,6 +53,7 @@ func TestSshAegisConfig_Validate(t *testing.T) {
 				ListenAddressesUnknown: testValidAddressesMixed,
 				SshdConfigFile:         validSshConfigFile,
 				WireguardInterface:     "wg0",
+				WireguardMaxAge:        180,
 				SshServiceName:         "ssh",
 				MetricsFile:            "contrib/configs/test.prom",
 			},
@@ -60,6 +67,7 @@ func TestSshAegisConfig_Validate(t *testing.T) {
 				ListenAddressesUnknown: nil,
 				SshdConfigFile:         validSshConfigFile,
 				WireguardInterface:     "wg0",
+				WireguardMaxAge:        180,
 				SshServiceName:         "ssh",
 				MetricsFile:            "contrib/configs/test.prom",
 			},
@@ -73,6 +81,7 @@ func TestSshAegisConfig_Validate(t *testing.T) {
 				ListenAddressesUnknown: nil,
 				SshdConfigFile:         validSshConfigFile,
 				WireguardInterface:     "wg0",
+				WireguardMaxAge:        180,
 				SshServiceName:         "ssh",
 				MetricsFile:            "contrib/configs/test.prom",
 			},
@@ -86,6 +95,7 @@ func TestSshAegisConfig_Validate(t *testing.T) {
 				ListenAddressesUnknown: testInvalidAddressIpv4,
 				SshdConfigFile:         validSshConfigFile,
 				WireguardInterface:     "wg0",
+				WireguardMaxAge:        180,
 				SshServiceName:         "ssh",
 				MetricsFile:            "contrib/configs/test.prom",
 			},
@@ -99,6 +109,7 @@ func TestSshAegisConfig_Validate(t *testing.T) {
 				ListenAddressesUnknown: nil,
 				SshdConfigFile:         validSshConfigFile,
 				WireguardInterface:     "wg0",
+				WireguardMaxAge:        180,
 				SshServiceName:         "ssh",
 				MetricsFile:            "contrib/configs/test.prom",
 			},
@@ -112,6 +123,7 @@ func TestSshAegisConfig_Validate(t *testing.T) {
 				ListenAddressesUnknown: nil,
 				SshdConfigFile:         "nonexistent",
 				WireguardInterface:     "wg0",
+				WireguardMaxAge:        180,
 				SshServiceName:         "ssh",
 				MetricsFile:            "contrib/configs/test.prom",
 			},
@@ -125,6 +137,7 @@ func TestSshAegisConfig_Validate(t *testing.T) {
 				ListenAddressesUnknown: nil,
 				SshdConfigFile:         validSshConfigFile,
 				WireguardInterface:     "wg0",
+				WireguardMaxAge:        180,
 				SshServiceName:         "",
 				MetricsFile:            "contrib/configs/test.prom",
 			},
@@ -138,22 +151,92 @@ func TestSshAegisConfig_Validate(t *testing.T) {
 				ListenAddressesUnknown: nil,
 				SshdConfigFile:         validSshConfigFile,
 				WireguardInterface:     "",
+				WireguardMaxAge:        180,
 				SshServiceName:         "sshd",
 				MetricsFile:            "contrib/configs/test.prom",
 			},
 			wantErr: true,
 		},
+		{
+			name: "addresses with port and rdomain",
+			fields: fields{
+				ListenAddressesUp:   []string{"[fd00::1]:2222", "10.8.0.1:2222"},
+				ListenAddressesDown: []string{"0.0.0.0 rdomain vrf0"},
+				SshdConfigFile:      validSshConfigFile,
+				WireguardInterface:  "wg0",
+				WireguardMaxAge:     180,
+				SshServiceName:      "sshd",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid port",
+			fields: fields{
+				ListenAddressesUp:   []string{"10.8.0.1:0"},
+				ListenAddressesDown: testValidAddressIpv4,
+				SshdConfigFile:      validSshConfigFile,
+				WireguardInterface:  "wg0",
+				WireguardMaxAge:     180,
+				SshServiceName:      "sshd",
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid wg peer",
+			fields: fields{
+				ListenAddressesUp:   testValidAddressIpv4,
+				ListenAddressesDown: testValidAddressIpv6,
+				SshdConfigFile:      validSshConfigFile,
+				WireguardInterface:  "wg0",
+				WireguardPeers:      []string{"xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg="},
+				WireguardMaxAge:     180,
+				SshServiceName:      "sshd",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid wg peer",
+			fields: fields{
+				ListenAddressesUp:   testValidAddressIpv4,
+				ListenAddressesDown: testValidAddressIpv6,
+				SshdConfigFile:      validSshConfigFile,
+				WireguardInterface:  "wg0",
+				WireguardPeers:      []string{"not-a-key"},
+				WireguardMaxAge:     180,
+				SshServiceName:      "sshd",
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero wg max handshake age",
+			fields: fields{
+				ListenAddressesUp:   testValidAddressIpv4,
+				ListenAddressesDown: testValidAddressIpv6,
+				SshdConfigFile:      validSshConfigFile,
+				WireguardInterface:  "wg0",
+				WireguardMaxAge:     0,
+				SshServiceName:      "sshd",
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			c := &SshAegisConfig{
-				ListenAddressesUp:      tt.fields.ListenAddressesUp,
-				ListenAddressesDown:    tt.fields.ListenAddressesDown,
-				ListenAddressesUnknown: tt.fields.ListenAddressesUnknown,
-				SshdConfigFile:         tt.fields.SshdConfigFile,
-				WireguardInterface:     tt.fields.WireguardInterface,
-				SshServiceName:         tt.fields.SshServiceName,
-				MetricsFile:            tt.fields.MetricsFile,
+				ListenAddressesUp:               tt.fields.ListenAddressesUp,
+				ListenAddressesDown:             tt.fields.ListenAddressesDown,
+				ListenAddressesUnknown:          tt.fields.ListenAddressesUnknown,
+				SshdConfigFile:                  tt.fields.SshdConfigFile,
+				SshdConfigMode:                  sshdConfigModeMain,
+				WireguardInterface:              tt.fields.WireguardInterface,
+				WireguardBackend:                wgBackendCli,
+				WireguardPeers:                  tt.fields.WireguardPeers,
+				WireguardMaxHandshakeAgeSeconds: tt.fields.WireguardMaxAge,
+				SshServiceName:                  tt.fields.SshServiceName,
+				CheckIntervalSeconds:            configDefaultCheckInterval,
+				SourcesPolicy:                   sourcesPolicyAny,
+				DriftMode:                       driftModeRepair,
+				MetricsFile:                     tt.fields.MetricsFile,
 			}
 			if err := c.Validate(); (err != nil) != tt.wantErr {
 				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
@@ -161,3 +244,439 @@ func TestSshAegisConfig_Validate(t *testing.T) {
 		})
 	}
 }
+
+func Test_getDefault(t *testing.T) {
+	conf := getDefault()
+	conf.ListenAddressesUp = testValidAddressIpv6
+	conf.SshdConfigFile = validSshConfigFile
+	if conf.SshdBinary != configDefaultSshdBinary {
+		t.Errorf("getDefault() SshdBinary = %q, want %q", conf.SshdBinary, configDefaultSshdBinary)
+	}
+
+	// the default sshd binary is not necessarily available, which must not render the default config invalid
+	if err := conf.Validate(); err != nil {
+		t.Errorf("Validate() of default config error = %v", err)
+	}
+
+	conf.SshdBinary = "/nonexistent/sshd"
+	if err := conf.Validate(); err == nil {
+		t.Errorf("Validate() expected error for explicitly configured sshd binary that does not exist")
+	}
+}
+
+func TestSshAegisConfig_ValidateSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []SourceConfig
+		policy  string
+		wantErr bool
+	}{
+		{
+			name: "two wireguard sources",
+			sources: []SourceConfig{
+				{Type: sourceTypeWireguard, WireguardInterface: "wg0"},
+				{Type: sourceTypeWireguard, WireguardInterface: "wg1", WireguardBackend: wgBackendNetlink},
+			},
+			policy: "all",
+		},
+		{
+			name: "quorum exceeding sources",
+			sources: []SourceConfig{
+				{Type: sourceTypeWireguard, WireguardInterface: "wg0"},
+				{Type: sourceTypeWireguard, WireguardInterface: "wg1"},
+			},
+			policy:  "quorum(3)",
+			wantErr: true,
+		},
+		{
+			name: "duplicate names",
+			sources: []SourceConfig{
+				{Type: sourceTypeWireguard, WireguardInterface: "wg0"},
+				{Name: "wg0", Type: sourceTypeWireguard, WireguardInterface: "wg1"},
+			},
+			policy:  "any",
+			wantErr: true,
+		},
+		{
+			name: "invalid name",
+			sources: []SourceConfig{
+				{Name: `site "a"`, Type: sourceTypeWireguard, WireguardInterface: "wg0"},
+			},
+			policy:  "any",
+			wantErr: true,
+		},
+		{
+			name: "wireguard and probe sources",
+			sources: []SourceConfig{
+				{Type: sourceTypeWireguard, WireguardInterface: "wg0"},
+				{Type: sourceTypeProbe, ProbeTargets: []string{"tcp://10.8.0.254:22", "icmp://10.8.0.254"}, ProbeMinSuccesses: 2},
+			},
+			policy: "all",
+		},
+		{
+			name: "invalid probe target",
+			sources: []SourceConfig{
+				{Type: sourceTypeProbe, ProbeTargets: []string{"udp://10.8.0.254:53"}},
+			},
+			policy:  "any",
+			wantErr: true,
+		},
+		{
+			name: "probe min successes exceeding targets",
+			sources: []SourceConfig{
+				{Type: sourceTypeProbe, ProbeTargets: []string{"icmp://10.8.0.254"}, ProbeMinSuccesses: 2},
+			},
+			policy:  "any",
+			wantErr: true,
+		},
+		{
+			name: "exec source",
+			sources: []SourceConfig{
+				{Name: "openvpn", Type: sourceTypeExec, ExecCommand: []string{"sh", "-c", "exit 0"}, ExecMatch: execMatchStdout},
+			},
+			policy: "any",
+		},
+		{
+			name: "exec command not found",
+			sources: []SourceConfig{
+				{Type: sourceTypeExec, ExecCommand: []string{"/nonexistent/ssh-aegis-check"}},
+			},
+			policy:  "any",
+			wantErr: true,
+		},
+		{
+			name: "invalid type",
+			sources: []SourceConfig{
+				{Name: "a", Type: "carrier-pigeon"},
+			},
+			policy:  "any",
+			wantErr: true,
+		},
+		{
+			name: "missing interface",
+			sources: []SourceConfig{
+				{Name: "a", Type: sourceTypeWireguard},
+			},
+			policy:  "any",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := getDefault()
+			conf.ListenAddressesUp = testValidAddressIpv6
+			conf.SshdConfigFile = validSshConfigFile
+			conf.SshdBinary = ""
+			conf.Sources = tt.sources
+			conf.SourcesPolicy = tt.policy
+			if err := conf.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSshAegisConfig_sourcesInterface(t *testing.T) {
+	conf := getDefault()
+	conf.ListenAddressesUp = []string{"10.8.0.1:2222", "[fd00::1]:22", "0.0.0.0", "10.8.0.1"}
+	conf.Sources = []SourceConfig{
+		{Type: sourceTypeInterface, Interface: "tun0"},
+		{Type: sourceTypeProbe, ProbeTargets: []string{"tcp://10.8.0.2:22"}},
+	}
+
+	got := conf.sources()
+	if want := []string{"10.8.0.1", "fd00::1"}; !reflect.DeepEqual(got[0].InterfaceAddresses, want) {
+		t.Errorf("sources() addresses = %v, want %v", got[0].InterfaceAddresses, want)
+	}
+	if got[0].Name != "tun0" {
+		t.Errorf("sources() name = %v, want tun0", got[0].Name)
+	}
+
+	conf.Sources[0].InterfaceAddresses = []string{}
+	if got := conf.sources(); len(got[0].InterfaceAddresses) != 0 {
+		t.Errorf("sources() addresses = %v, want none", got[0].InterfaceAddresses)
+	}
+}
+
+func TestSshAegisConfig_sourcesMultipleInterfaces(t *testing.T) {
+	conf := getDefault()
+	conf.ListenAddressesUp = []string{"10.8.0.1", "10.9.0.1"}
+	conf.SshdConfigFile = validSshConfigFile
+	conf.SshdBinary = ""
+	conf.SourcesPolicy = sourcesPolicyAny
+	conf.Sources = []SourceConfig{
+		{Type: sourceTypeInterface, Interface: "tun0"},
+		{Type: sourceTypeInterface, Interface: "tun1"},
+	}
+
+	// each interface only holds some of the addresses, so none of them can be required by default
+	for _, source := range conf.sources() {
+		if source.InterfaceAddresses != nil {
+			t.Errorf("sources() addresses of %s = %v, want none", source.Name, source.InterfaceAddresses)
+		}
+	}
+	if err := conf.Validate(); err == nil {
+		t.Errorf("Validate() expected error without interface addresses")
+	}
+
+	conf.Sources[0].InterfaceAddresses = []string{"10.8.0.1"}
+	conf.Sources[1].InterfaceAddresses = []string{"10.9.0.1"}
+	if err := conf.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	if want := []string{"tun0", "tun1"}; !reflect.DeepEqual(conf.watchedInterfaces(), want) {
+		t.Errorf("watchedInterfaces() = %v, want %v", conf.watchedInterfaces(), want)
+	}
+}
+
+func TestSshAegisConfig_sources(t *testing.T) {
+	conf := getDefault()
+	conf.WireguardInterface = "wg1"
+	conf.WireguardBackend = wgBackendNetlink
+	conf.WireguardPeers = []string{"xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg="}
+
+	want := []SourceConfig{{
+		Name:                            "wg1",
+		Type:                            sourceTypeWireguard,
+		WireguardInterface:              "wg1",
+		WireguardBackend:                wgBackendNetlink,
+		WireguardPeers:                  conf.WireguardPeers,
+		WireguardMaxHandshakeAgeSeconds: configDefaultWireguardMaxHandshakeAge,
+	}}
+	if got := conf.sources(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sources() legacy = %v, want %v", got, want)
+	}
+
+	conf.Sources = []SourceConfig{
+		{Name: "site-a", Type: sourceTypeWireguard, WireguardInterface: "wg0", WireguardMaxHandshakeAgeSeconds: 60},
+	}
+	want = []SourceConfig{{
+		Name:                            "site-a",
+		Type:                            sourceTypeWireguard,
+		WireguardInterface:              "wg0",
+		WireguardBackend:                wgBackendNetlink,
+		WireguardMaxHandshakeAgeSeconds: 60,
+	}}
+	if got := conf.sources(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sources() = %v, want %v", got, want)
+	}
+	if conf.Sources[0].WireguardBackend != "" {
+		t.Errorf("sources() modified configured sources")
+	}
+}
+
+func TestSshAegisConfig_ValidateShutdown(t *testing.T) {
+	tests := []struct {
+		name          string
+		restoreOnExit bool
+		shutdown      []string
+		wantErr       bool
+	}{
+		{
+			name:          "restore original addresses",
+			restoreOnExit: true,
+		},
+		{
+			name:          "shutdown addresses",
+			restoreOnExit: true,
+			shutdown:      []string{"0.0.0.0"},
+		},
+		{
+			name:     "shutdown addresses without restore_on_exit",
+			shutdown: []string{"0.0.0.0"},
+			wantErr:  true,
+		},
+		{
+			name:          "invalid shutdown address",
+			restoreOnExit: true,
+			shutdown:      []string{"not-an-address"},
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := getDefault()
+			conf.ListenAddressesUp = []string{"10.8.0.1"}
+			conf.ListenAddressesDown = testValidAddressIpv4
+			conf.SshdConfigFile = validSshConfigFile
+			conf.SshdBinary = ""
+			conf.RestoreOnExit = tt.restoreOnExit
+			conf.ListenAddressesShutdown = tt.shutdown
+			if err := conf.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSshAegisConfig_ValidateLockout(t *testing.T) {
+	tests := []struct {
+		name         string
+		timeout      int
+		probeTargets []string
+		confirmFile  string
+		wantErr      bool
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:         "enabled",
+			timeout:      300,
+			probeTargets: []string{"tcp://10.8.0.2:22"},
+			confirmFile:  "/run/ssh-aegis/confirm",
+		},
+		{
+			name:    "negative timeout",
+			timeout: -1,
+			wantErr: true,
+		},
+		{
+			name:        "confirm file without timeout",
+			confirmFile: "/run/ssh-aegis/confirm",
+			wantErr:     true,
+		},
+		{
+			name:         "invalid probe target",
+			timeout:      300,
+			probeTargets: []string{"udp://10.8.0.2:22"},
+			wantErr:      true,
+		},
+		{
+			name:        "relative confirm file",
+			timeout:     300,
+			confirmFile: "confirm",
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := getDefault()
+			conf.ListenAddressesUp = []string{"10.8.0.1"}
+			conf.ListenAddressesDown = testValidAddressIpv4
+			conf.SshdConfigFile = validSshConfigFile
+			conf.SshdBinary = ""
+			conf.LockoutTimeoutSeconds = tt.timeout
+			conf.LockoutProbeTargets = tt.probeTargets
+			conf.LockoutConfirmFile = tt.confirmFile
+			if err := conf.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSshAegisConfig_ValidateFirewall(t *testing.T) {
+	tests := []struct {
+		name      string
+		firewall  string
+		nftBinary string
+		allowed   []string
+		wantErr   bool
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:      "nftables",
+			firewall:  firewallNftables,
+			nftBinary: "sh",
+			allowed:   []string{"192.0.2.0/24", "bastion.example.com"},
+		},
+		{
+			name:      "unknown firewall",
+			firewall:  "iptables",
+			nftBinary: "sh",
+			allowed:   []string{"192.0.2.0/24"},
+			wantErr:   true,
+		},
+		{
+			name:    "allowed sources without firewall",
+			allowed: []string{"192.0.2.0/24"},
+			wantErr: true,
+		},
+		{
+			name:      "no allowed sources",
+			firewall:  firewallNftables,
+			nftBinary: "sh",
+			wantErr:   true,
+		},
+		{
+			name:      "invalid allowed source",
+			firewall:  firewallNftables,
+			nftBinary: "sh",
+			allowed:   []string{"192.0.2.0/33"},
+			wantErr:   true,
+		},
+		{
+			name:      "nft binary not found",
+			firewall:  firewallNftables,
+			nftBinary: "/nonexistent/nft",
+			allowed:   []string{"192.0.2.0/24"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := getDefault()
+			conf.ListenAddressesUp = []string{"10.8.0.1"}
+			conf.ListenAddressesDown = testValidAddressIpv4
+			conf.SshdConfigFile = validSshConfigFile
+			conf.SshdBinary = ""
+			conf.Firewall = tt.firewall
+			conf.NftBinary = tt.nftBinary
+			conf.FirewallAllowedSources = tt.allowed
+			if err := conf.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSshAegisConfig_ValidateRules(t *testing.T) {
+	sources := []SourceConfig{
+		{Type: sourceTypeWireguard, WireguardInterface: "wg0"},
+		{Type: sourceTypeWireguard, WireguardInterface: "wg1"},
+	}
+
+	tests := []struct {
+		name    string
+		up      []string
+		rules   []AddressRule
+		wantErr bool
+	}{
+		{
+			name:  "exhaustive rules",
+			rules: testSiteRules,
+		},
+		{
+			name:    "rules not exhaustive",
+			rules:   testSiteRules[:3],
+			wantErr: true,
+		},
+		{
+			name:    "rules combined with up addresses",
+			up:      testValidAddressIpv4,
+			rules:   testSiteRules,
+			wantErr: true,
+		},
+		{
+			name:    "no addresses to fall back to",
+			rules:   append([]AddressRule{{Status: "down", Addresses: []string{}}}, testSiteRules...),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := getDefault()
+			conf.ListenAddressesUp = tt.up
+			conf.SshdConfigFile = validSshConfigFile
+			conf.SshdBinary = ""
+			conf.Sources = sources
+			conf.Rules = tt.rules
+			if err := conf.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
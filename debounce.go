@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+type TransitionThreshold struct {
+	// MinReadings is the number of consecutive readings of the new status required before acting on it
+	MinReadings int `json:"min_readings,omitempty"`
+	// StableSeconds is the duration the new status needs to be observed before acting on it
+	StableSeconds int `json:"stable_seconds,omitempty"`
+}
+
+// statusDebouncer suppresses status transitions until the new status has been read a configured number of times in
+// a row and/or for a configured duration. Thresholds are configured per target status, so e.g. falling back to
+// public addresses can happen immediately while switching to private addresses requires a stable tunnel.
+type statusDebouncer struct {
+	thresholds map[TunnelStatus]TransitionThreshold
+	now        func() time.Time
+
+	hasCandidate   bool
+	candidate      TunnelStatus
+	candidateSince time.Time
+	readings       int
+}
+
+func newStatusDebouncer(thresholds map[TunnelStatus]TransitionThreshold) *statusDebouncer {
+	return &statusDebouncer{
+		thresholds: thresholds,
+		now:        time.Now,
+	}
+}
+
+// Observe takes the current status and a new reading and returns the status to act on. Only scheduled readings, i.e.
+// readings taken on the check interval, count towards MinReadings. Readings triggered by events arrive in bursts, so
+// they only start or reset a pending transition.
+func (d *statusDebouncer) Observe(current TunnelStatus, reading TunnelStatus, scheduled bool) TunnelStatus {
+	if reading == current {
+		if d.hasCandidate {
+			slog.Info("Suppressed status flap", "status", current, "candidate", d.candidate, "readings", d.readings)
+			metrics.SuppressedFlaps++
+			d.reset()
+		}
+		return current
+	}
+
+	now := d.now()
+	if d.hasCandidate && d.candidate == reading {
+		if scheduled {
+			d.readings++
+		}
+	} else {
+		if d.hasCandidate {
+			slog.Info("Suppressed status flap", "status", current, "candidate", d.candidate, "readings", d.readings)
+			metrics.SuppressedFlaps++
+		}
+		d.hasCandidate = true
+		d.candidate = reading
+		d.candidateSince = now
+		d.readings = 0
+		if scheduled {
+			d.readings = 1
+		}
+	}
+
+	threshold := d.thresholds[reading]
+	stableFor := now.Sub(d.candidateSince)
+	// a single reading is enough, regardless of what triggered it
+	enoughReadings := threshold.MinReadings <= 1 || d.readings >= threshold.MinReadings
+	if enoughReadings && stableFor >= time.Duration(threshold.StableSeconds)*time.Second {
+		d.reset()
+		return reading
+	}
+
+	slog.Info("Status change pending", "from", current, "to", reading, "readings", d.readings, "stable_for", stableFor)
+	return current
+}
+
+func (d *statusDebouncer) reset() {
+	d.hasCandidate = false
+	d.readings = 0
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatusDebouncer_Observe(t *testing.T) {
+	type reading struct {
+		after  time.Duration
+		status TunnelStatus
+		event  bool
+		want   TunnelStatus
+	}
+
+	tests := []struct {
+		name           string
+		thresholds     map[TunnelStatus]TransitionThreshold
+		current        TunnelStatus
+		readings       []reading
+		wantSuppressed int
+	}{
+		{
+			name:       "no thresholds, immediate transition",
+			thresholds: map[TunnelStatus]TransitionThreshold{},
+			current:    Down,
+			readings: []reading{
+				{status: Up, want: Up},
+			},
+		},
+		{
+			name: "consecutive readings required",
+			thresholds: map[TunnelStatus]TransitionThreshold{
+				Up: {MinReadings: 3},
+			},
+			current: Down,
+			readings: []reading{
+				{status: Up, want: Down},
+				{status: Up, want: Down},
+				{status: Up, want: Up},
+			},
+		},
+		{
+			name: "flap resets consecutive readings",
+			thresholds: map[TunnelStatus]TransitionThreshold{
+				Up: {MinReadings: 2},
+			},
+			current: Down,
+			readings: []reading{
+				{status: Up, want: Down},
+				{status: Down, want: Down},
+				{status: Up, want: Down},
+				{status: Up, want: Up},
+			},
+			wantSuppressed: 1,
+		},
+		{
+			name: "stable duration required",
+			thresholds: map[TunnelStatus]TransitionThreshold{
+				Up: {StableSeconds: 300},
+			},
+			current: Down,
+			readings: []reading{
+				{status: Up, want: Down},
+				{after: 2 * time.Minute, status: Up, want: Down},
+				{after: 3 * time.Minute, status: Up, want: Up},
+			},
+		},
+		{
+			name: "thresholds per direction",
+			thresholds: map[TunnelStatus]TransitionThreshold{
+				Up:   {StableSeconds: 300},
+				Down: {MinReadings: 1},
+			},
+			current: Up,
+			readings: []reading{
+				{status: Down, want: Down},
+				{after: time.Minute, status: Up, want: Down},
+				{after: time.Minute, status: Down, want: Down},
+			},
+			wantSuppressed: 1,
+		},
+		{
+			name: "event readings do not count",
+			thresholds: map[TunnelStatus]TransitionThreshold{
+				Up: {MinReadings: 3},
+			},
+			current: Down,
+			readings: []reading{
+				{status: Up, event: true, want: Down},
+				{status: Up, event: true, want: Down},
+				{status: Up, event: true, want: Down},
+				{status: Up, want: Down},
+				{status: Up, event: true, want: Down},
+				{status: Up, want: Down},
+				{status: Up, want: Up},
+			},
+		},
+		{
+			name: "event reading resets pending candidate",
+			thresholds: map[TunnelStatus]TransitionThreshold{
+				Up: {MinReadings: 2},
+			},
+			current: Down,
+			readings: []reading{
+				{status: Up, want: Down},
+				{status: Down, event: true, want: Down},
+				{status: Up, want: Down},
+				{status: Up, want: Up},
+			},
+			wantSuppressed: 1,
+		},
+		{
+			name: "event reading is enough for a single reading",
+			thresholds: map[TunnelStatus]TransitionThreshold{
+				Down: {MinReadings: 1},
+			},
+			current: Up,
+			readings: []reading{
+				{status: Down, event: true, want: Down},
+			},
+		},
+		{
+			name: "other candidate replaces pending candidate",
+			thresholds: map[TunnelStatus]TransitionThreshold{
+				Up:      {MinReadings: 2},
+				Unknown: {MinReadings: 2},
+			},
+			current: Down,
+			readings: []reading{
+				{status: Up, want: Down},
+				{status: Unknown, want: Down},
+				{status: Unknown, want: Unknown},
+			},
+			wantSuppressed: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics.SuppressedFlaps = 0
+			now := time.Unix(1700000000, 0)
+			d := newStatusDebouncer(tt.thresholds)
+			d.now = func() time.Time { return now }
+
+			current := tt.current
+			for idx, r := range tt.readings {
+				now = now.Add(r.after)
+				current = d.Observe(current, r.status, !r.event)
+				if current != r.want {
+					t.Errorf("Observe() reading %d = %v, want %v", idx, current, r.want)
+				}
+			}
+
+			if metrics.SuppressedFlaps != tt.wantSuppressed {
+				t.Errorf("suppressed flaps = %d, want %d", metrics.SuppressedFlaps, tt.wantSuppressed)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContextLines = 3
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// unifiedDiff returns the differences between a and b in unified diff format or an empty string if both are equal.
+func unifiedDiff(name string, a, b []string) string {
+	ops := diffLines(a, b)
+
+	var hunks strings.Builder
+	for start := 0; start < len(ops); {
+		// find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// extend the hunk as long as changes are separated by less than twice the context
+		hunkStart := max(0, start-diffContextLines)
+		end := start
+		for idx := start; idx < len(ops); idx++ {
+			if ops[idx].kind != ' ' {
+				end = idx + 1
+			} else if idx-end >= 2*diffContextLines {
+				break
+			}
+		}
+		hunkEnd := min(len(ops), end+diffContextLines)
+
+		aStart, bStart := diffPositions(ops[:hunkStart])
+		aLen, bLen := diffPositions(ops[hunkStart:hunkEnd])
+		fmt.Fprintf(&hunks, "@@ -%s +%s @@\n", diffRange(aStart, aLen), diffRange(bStart, bLen))
+		for _, op := range ops[hunkStart:hunkEnd] {
+			fmt.Fprintf(&hunks, "%c%s\n", op.kind, op.line)
+		}
+
+		start = hunkEnd
+	}
+
+	if hunks.Len() == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("--- %s\n+++ %s\n%s", name, name, hunks.String())
+}
+
+// diffLines computes the edit script transforming a into b based on their longest common subsequence.
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+
+	return ops
+}
+
+// diffPositions returns the number of lines of a and b covered by ops.
+func diffPositions(ops []diffOp) (int, int) {
+	aLines, bLines := 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			aLines++
+		}
+		if op.kind != '-' {
+			bLines++
+		}
+	}
+
+	return aLines, bLines
+}
+
+func diffRange(offset, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", offset)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", offset+1)
+	}
+
+	return fmt.Sprintf("%d,%d", offset+1, length)
+}
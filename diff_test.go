@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func Test_unifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a    []string
+		b    []string
+		want string
+	}{
+		{
+			name: "equal",
+			a:    []string{"Port 22", "ListenAddress 0.0.0.0"},
+			b:    []string{"Port 22", "ListenAddress 0.0.0.0"},
+			want: "",
+		},
+		{
+			name: "replaced line",
+			a:    []string{"Port 22", "ListenAddress 0.0.0.0", "PermitRootLogin no"},
+			b:    []string{"Port 22", "ListenAddress 10.8.0.1", "PermitRootLogin no"},
+			want: "--- sshd_config\n+++ sshd_config\n" +
+				"@@ -1,3 +1,3 @@\n" +
+				" Port 22\n" +
+				"-ListenAddress 0.0.0.0\n" +
+				"+ListenAddress 10.8.0.1\n" +
+				" PermitRootLogin no\n",
+		},
+		{
+			name: "added to empty file",
+			a:    nil,
+			b:    []string{"ListenAddress 10.8.0.1"},
+			want: "--- sshd_config\n+++ sshd_config\n" +
+				"@@ -0,0 +1 @@\n" +
+				"+ListenAddress 10.8.0.1\n",
+		},
+		{
+			name: "separate hunks",
+			a:    []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"},
+			b:    []string{"A", "b", "c", "d", "e", "f", "g", "h", "i", "J"},
+			want: "--- sshd_config\n+++ sshd_config\n" +
+				"@@ -1,4 +1,4 @@\n" +
+				"-a\n" +
+				"+A\n" +
+				" b\n" +
+				" c\n" +
+				" d\n" +
+				"@@ -7,4 +7,4 @@\n" +
+				" g\n" +
+				" h\n" +
+				" i\n" +
+				"-j\n" +
+				"+J\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("sshd_config", tt.a, tt.b); got != tt.want {
+				t.Errorf("unifiedDiff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// dryRunConfigWrapper reads the config from the wrapped ConfigWrapper but only prints a diff instead of writing it.
+type dryRunConfigWrapper struct {
+	wrapped ConfigWrapper
+	name    string
+	out     io.Writer
+}
+
+func newDryRunConfigWrapper(wrapped ConfigWrapper, name string, out io.Writer) *dryRunConfigWrapper {
+	return &dryRunConfigWrapper{
+		wrapped: wrapped,
+		name:    name,
+		out:     out,
+	}
+}
+
+func (w *dryRunConfigWrapper) GetConfig() ([]string, error) {
+	return w.wrapped.GetConfig()
+}
+
+func (w *dryRunConfigWrapper) GetEffectiveConfig() ([]sshdConfigLine, error) {
+	if reader, ok := w.wrapped.(EffectiveConfigReader); ok {
+		return reader.GetEffectiveConfig()
+	}
+
+	current, err := w.wrapped.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return parseSshdConfig("", current), nil
+}
+
+func (w *dryRunConfigWrapper) WriteConfig(data []string) error {
+	current, err := w.wrapped.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	if renderer, ok := w.wrapped.(ConfigRenderer); ok {
+		data = renderer.RenderConfig(data)
+	}
+
+	_, err = fmt.Fprint(w.out, unifiedDiff(w.name, current, data))
+	return err
+}
+
+// dryRunServiceReloader prints the service action instead of performing it.
+type dryRunServiceReloader struct {
+	wrapped  ServiceReloader
+	unitName string
+	out      io.Writer
+}
+
+func (r *dryRunServiceReloader) RestartSsh() error {
+	_, err := fmt.Fprintf(r.out, "Would restart %s\n", r.unitName)
+	return err
+}
+
+func (r *dryRunServiceReloader) UnitExists() error {
+	return r.wrapped.UnitExists()
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// execMatchExitCode maps the exit code of the command to a status
+	execMatchExitCode = "exit_code"
+	// execMatchStdout maps the first line of the command's output to a status
+	execMatchStdout = "stdout"
+
+	// execWaitDelay limits waiting for the output of processes that outlive the command, e.g. after a timeout
+	execWaitDelay = time.Second
+)
+
+var execMatches = []string{execMatchExitCode, execMatchStdout}
+
+// defaultExecMappings are used if no mapping is configured. Unmapped results are unknown.
+var defaultExecMappings = map[string]map[string]string{
+	execMatchExitCode: {"0": "up", "1": "down"},
+	execMatchStdout:   {"up": "up", "down": "down", "unknown": "unknown"},
+}
+
+// ExecStatus runs a command and maps its exit code or output to a status. The previous status of the source is
+// passed to the command as environment variables, so scripts can be stateful.
+type ExecStatus struct {
+	name    string
+	command []string
+	timeout time.Duration
+	match   string
+	mapping map[string]TunnelStatus
+	now     func() time.Time
+
+	previous       TunnelStatus
+	previousChange time.Time
+}
+
+func NewExecStatus(name string, command []string, timeout time.Duration, match string, mapping map[string]string) (*ExecStatus, error) {
+	if len(command) == 0 || command[0] == "" {
+		return nil, errors.New("no command provided")
+	}
+
+	if timeout <= 0 {
+		return nil, errors.New("exec timeout must be positive")
+	}
+
+	parsedMapping, err := parseExecMapping(match, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExecStatus{
+		name:     name,
+		command:  command,
+		timeout:  timeout,
+		match:    match,
+		mapping:  parsedMapping,
+		now:      time.Now,
+		previous: Unknown,
+	}, nil
+}
+
+// parseExecMapping validates the mapping of exit codes or keywords to statuses. Keywords are matched
+// case-insensitively.
+func parseExecMapping(match string, mapping map[string]string) (map[string]TunnelStatus, error) {
+	if !slices.Contains(execMatches, match) {
+		return nil, fmt.Errorf("invalid exec match %q, must be one of %v", match, execMatches)
+	}
+
+	if len(mapping) == 0 {
+		mapping = defaultExecMappings[match]
+	}
+
+	parsed := make(map[string]TunnelStatus, len(mapping))
+	for key, value := range mapping {
+		status, found := parseTunnelStatus(value)
+		if !found {
+			return nil, fmt.Errorf("invalid status %q for %q", value, key)
+		}
+
+		switch match {
+		case execMatchExitCode:
+			if _, err := strconv.Atoi(key); err != nil {
+				return nil, fmt.Errorf("invalid exit code %q", key)
+			}
+		case execMatchStdout:
+			key = strings.ToLower(strings.TrimSpace(key))
+		}
+		parsed[key] = status
+	}
+
+	return parsed, nil
+}
+
+func (e *ExecStatus) GetStatus() TunnelStatus {
+	status := e.run()
+	if status != e.previous || e.previousChange.IsZero() {
+		e.previous = status
+		e.previousChange = e.now()
+	}
+
+	return status
+}
+
+func (e *ExecStatus) run() TunnelStatus {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	var previousChange int64
+	if !e.previousChange.IsZero() {
+		previousChange = e.previousChange.Unix()
+	}
+
+	cmd := exec.CommandContext(ctx, e.command[0], e.command[1:]...) //nolint:gosec
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("SSH_AEGIS_SOURCE=%s", e.name),
+		fmt.Sprintf("SSH_AEGIS_STATUS=%s", metrics.Status),
+		fmt.Sprintf("SSH_AEGIS_PREVIOUS_STATUS=%s", e.previous),
+		fmt.Sprintf("SSH_AEGIS_PREVIOUS_STATUS_CHANGE=%d", previousChange),
+	)
+	cmd.WaitDelay = execWaitDelay
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if stderr.Len() > 0 {
+		slog.Debug("Command wrote to stderr", "source", e.name, "stderr", strings.TrimSpace(stderr.String()))
+	}
+
+	if ctx.Err() != nil {
+		slog.Warn("Command timed out", "source", e.name, "command", e.command, "timeout", e.timeout)
+		return Unknown
+	}
+
+	exitCode := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			slog.Warn("Could not run command", "source", e.name, "command", e.command, "err", err)
+			return Unknown
+		}
+		exitCode = exitErr.ExitCode()
+	}
+
+	key := strconv.Itoa(exitCode)
+	if e.match == execMatchStdout {
+		line, _, _ := strings.Cut(stdout.String(), "\n")
+		key = strings.ToLower(strings.TrimSpace(line))
+	}
+
+	status, found := e.mapping[key]
+	if !found {
+		slog.Debug("No status mapped for command result, assuming unknown", "source", e.name, "exit_code", exitCode, "result", key)
+		return Unknown
+	}
+
+	return status
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExecStatus_GetStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		command []string
+		timeout time.Duration
+		match   string
+		mapping map[string]string
+		want    []TunnelStatus
+	}{
+		{
+			name:    "exit code up",
+			command: []string{"sh", "-c", "exit 0"},
+			match:   execMatchExitCode,
+			want:    []TunnelStatus{Up},
+		},
+		{
+			name:    "exit code down",
+			command: []string{"sh", "-c", "exit 1"},
+			match:   execMatchExitCode,
+			want:    []TunnelStatus{Down},
+		},
+		{
+			name:    "exit code not mapped",
+			command: []string{"sh", "-c", "exit 3"},
+			match:   execMatchExitCode,
+			want:    []TunnelStatus{Unknown},
+		},
+		{
+			name:    "custom exit code mapping",
+			command: []string{"sh", "-c", "exit 3"},
+			match:   execMatchExitCode,
+			mapping: map[string]string{"3": "down"},
+			want:    []TunnelStatus{Down},
+		},
+		{
+			name:    "stdout keyword",
+			command: []string{"sh", "-c", "echo ' Up '; echo details; exit 1"},
+			match:   execMatchStdout,
+			want:    []TunnelStatus{Up},
+		},
+		{
+			name:    "custom stdout keyword",
+			command: []string{"sh", "-c", "echo CONNECTED"},
+			match:   execMatchStdout,
+			mapping: map[string]string{"Connected": "up", "Disconnected": "down"},
+			want:    []TunnelStatus{Up},
+		},
+		{
+			name:    "command not found",
+			command: []string{"/nonexistent/ssh-aegis-check"},
+			match:   execMatchExitCode,
+			want:    []TunnelStatus{Unknown},
+		},
+		{
+			name:    "timeout",
+			command: []string{"sleep", "5"},
+			timeout: 100 * time.Millisecond,
+			match:   execMatchExitCode,
+			want:    []TunnelStatus{Unknown},
+		},
+		{
+			name:    "previous status passed",
+			command: []string{"sh", "-c", "echo $SSH_AEGIS_SOURCE-$SSH_AEGIS_PREVIOUS_STATUS"},
+			match:   execMatchStdout,
+			mapping: map[string]string{"test-unknown": "down", "test-down": "up", "test-up": "up"},
+			want:    []TunnelStatus{Down, Up, Up},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeout := tt.timeout
+			if timeout == 0 {
+				timeout = 5 * time.Second
+			}
+			e, err := NewExecStatus("test", tt.command, timeout, tt.match, tt.mapping)
+			if err != nil {
+				t.Fatalf("NewExecStatus() error = %v", err)
+			}
+
+			for idx, want := range tt.want {
+				if got := e.GetStatus(); got != want {
+					t.Errorf("GetStatus() #%d = %v, want %v", idx+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_parseExecMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		match   string
+		mapping map[string]string
+		want    map[string]TunnelStatus
+		wantErr bool
+	}{
+		{
+			name:  "default exit codes",
+			match: execMatchExitCode,
+			want:  map[string]TunnelStatus{"0": Up, "1": Down},
+		},
+		{
+			name:    "keywords lowercased",
+			match:   execMatchStdout,
+			mapping: map[string]string{"ESTABLISHED": "up"},
+			want:    map[string]TunnelStatus{"established": Up},
+		},
+		{
+			name:    "invalid exit code",
+			match:   execMatchExitCode,
+			mapping: map[string]string{"zero": "up"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid status",
+			match:   execMatchStdout,
+			mapping: map[string]string{"ok": "fine"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid match",
+			match:   "stderr",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExecMapping(tt.match, tt.mapping)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseExecMapping() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseExecMapping() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
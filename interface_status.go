@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	sysfsNetRoot = "/sys/class/net"
+
+	// operstates as documented in Documentation/ABI/testing/sysfs-class-net
+	operstateUp      = "up"
+	operstateUnknown = "unknown"
+)
+
+// InterfaceStatus reports a network interface as up if its operstate is up, or unknown as e.g. for tun devices, its
+// carrier is detected and all configured addresses are assigned to it. sshd fails to start if it's configured to
+// listen on an address that is not assigned.
+type InterfaceStatus struct {
+	interfaceName string
+	addresses     []net.IP
+	sysfsRoot     string
+	addrs         func(interfaceName string) ([]net.IP, error)
+}
+
+func NewInterfaceStatus(interfaceName string, addresses []string) (*InterfaceStatus, error) {
+	if interfaceName == "" {
+		return nil, errors.New("empty interface name provided")
+	}
+
+	parsed, err := parseInterfaceAddresses(addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InterfaceStatus{
+		interfaceName: interfaceName,
+		addresses:     parsed,
+		sysfsRoot:     sysfsNetRoot,
+		addrs:         interfaceAddrs,
+	}, nil
+}
+
+func parseInterfaceAddresses(addresses []string) ([]net.IP, error) {
+	parsed := make([]net.IP, 0, len(addresses))
+	for _, addr := range addresses {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid interface address supplied: %s", addr)
+		}
+		parsed = append(parsed, ip)
+	}
+
+	return parsed, nil
+}
+
+// SetAddresses replaces the addresses that need to be assigned to the interface.
+func (i *InterfaceStatus) SetAddresses(addresses []string) error {
+	parsed, err := parseInterfaceAddresses(addresses)
+	if err != nil {
+		return err
+	}
+
+	i.addresses = parsed
+	return nil
+}
+
+func (i *InterfaceStatus) GetStatus() TunnelStatus {
+	operstate, err := i.readAttribute("operstate")
+	if err != nil {
+		slog.Debug("could not read interface operstate", "interface", i.interfaceName, "err", err)
+		return Down
+	}
+
+	switch operstate {
+	case operstateUp:
+	case operstateUnknown:
+		// the carrier can only be read while the interface is administratively up
+		carrier, err := i.readAttribute("carrier")
+		if err != nil || carrier != "1" {
+			slog.Debug("Interface has no carrier", "interface", i.interfaceName, "carrier", carrier, "err", err)
+			return Down
+		}
+	default:
+		slog.Debug("Interface is not up", "interface", i.interfaceName, "operstate", operstate)
+		return Down
+	}
+
+	if len(i.addresses) == 0 {
+		return Up
+	}
+
+	assigned, err := i.addrs(i.interfaceName)
+	if err != nil {
+		slog.Debug("could not read interface addresses", "interface", i.interfaceName, "err", err)
+		return Down
+	}
+
+	for _, addr := range i.addresses {
+		if !slices.ContainsFunc(assigned, addr.Equal) {
+			slog.Debug("Address is not assigned to interface", "interface", i.interfaceName, "address", addr)
+			return Down
+		}
+	}
+
+	return Up
+}
+
+func (i *InterfaceStatus) readAttribute(attribute string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(i.sysfsRoot, i.interfaceName, attribute))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+func interfaceAddrs(interfaceName string) ([]net.IP, error) {
+	iface, err := net.InterfaceByName(interfaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+
+	return ips, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInterfaceStatus_GetStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		attributes map[string]string
+		addresses  []string
+		assigned   []string
+		addrsErr   error
+		want       TunnelStatus
+	}{
+		{
+			name:       "operstate up",
+			attributes: map[string]string{"operstate": "up\n", "carrier": "1\n"},
+			want:       Up,
+		},
+		{
+			name:       "operstate unknown with carrier",
+			attributes: map[string]string{"operstate": "unknown\n", "carrier": "1\n"},
+			want:       Up,
+		},
+		{
+			name:       "operstate unknown without carrier",
+			attributes: map[string]string{"operstate": "unknown\n", "carrier": "0\n"},
+			want:       Down,
+		},
+		{
+			name:       "operstate unknown, administratively down",
+			attributes: map[string]string{"operstate": "unknown\n"},
+			want:       Down,
+		},
+		{
+			name:       "operstate down",
+			attributes: map[string]string{"operstate": "down\n"},
+			want:       Down,
+		},
+		{
+			name:       "operstate lowerlayerdown",
+			attributes: map[string]string{"operstate": "lowerlayerdown\n"},
+			want:       Down,
+		},
+		{
+			name:       "interface missing",
+			attributes: nil,
+			want:       Down,
+		},
+		{
+			name:       "addresses assigned",
+			attributes: map[string]string{"operstate": "up\n"},
+			addresses:  []string{"10.8.0.1", "fd00::1"},
+			assigned:   []string{"fe80::1", "fd00:0::1", "10.8.0.1"},
+			want:       Up,
+		},
+		{
+			name:       "address not assigned",
+			attributes: map[string]string{"operstate": "up\n"},
+			addresses:  []string{"10.8.0.1", "fd00::1"},
+			assigned:   []string{"10.8.0.1"},
+			want:       Down,
+		},
+		{
+			name:       "addresses not readable",
+			attributes: map[string]string{"operstate": "up\n"},
+			addresses:  []string{"10.8.0.1"},
+			addrsErr:   errors.New("no such network interface"),
+			want:       Down,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if tt.attributes != nil {
+				dir := filepath.Join(root, "tun0")
+				if err := os.Mkdir(dir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				for attribute, value := range tt.attributes {
+					if err := os.WriteFile(filepath.Join(dir, attribute), []byte(value), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			i, err := NewInterfaceStatus("tun0", tt.addresses)
+			if err != nil {
+				t.Fatalf("NewInterfaceStatus() error = %v", err)
+			}
+			i.sysfsRoot = root
+			i.addrs = func(_ string) ([]net.IP, error) {
+				var ips []net.IP
+				for _, addr := range tt.assigned {
+					ips = append(ips, net.ParseIP(addr))
+				}
+				return ips, tt.addrsErr
+			}
+
+			if got := i.GetStatus(); got != tt.want {
+				t.Errorf("GetStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_interfaceAddrs(t *testing.T) {
+	addrs, err := interfaceAddrs("lo")
+	if err != nil {
+		t.Skipf("loopback interface not available: %v", err)
+	}
+
+	found := false
+	for _, addr := range addrs {
+		if addr.Equal(net.ParseIP("127.0.0.1")) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("interfaceAddrs() = %v, want 127.0.0.1 to be assigned to lo", addrs)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	linkWatcherPollTimeout = time.Second
+
+	// multicast groups taken from linux/rtnetlink.h
+	rtmgrpLink       = 0x1
+	rtmgrpIpv4Ifaddr = 0x10
+	rtmgrpIpv6Ifaddr = 0x100
+)
+
+// LinkWatcher subscribes to rtnetlink link and address notifications and reports changes of the watched interfaces.
+type LinkWatcher struct {
+	interfaces []string
+	conn       *netlinkConn
+}
+
+func NewLinkWatcher(interfaces []string) (*LinkWatcher, error) {
+	if len(interfaces) == 0 {
+		return nil, errors.New("no interfaces to watch provided")
+	}
+
+	groups := uint32(rtmgrpLink | rtmgrpIpv4Ifaddr | rtmgrpIpv6Ifaddr)
+	conn, err := newNetlinkConn(syscall.NETLINK_ROUTE, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	// a read timeout allows checking for the context to be cancelled regularly
+	if err := conn.setReadTimeout(linkWatcherPollTimeout); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return &LinkWatcher{
+		interfaces: interfaces,
+		conn:       conn,
+	}, nil
+}
+
+// Watch blocks until ctx is cancelled and sends the name of a watched interface to events whenever its link state or
+// addresses change. Events are dropped if the receiver is busy, as a single pending event suffices to trigger a check.
+func (w *LinkWatcher) Watch(ctx context.Context, events chan<- string) {
+	defer w.conn.Close()
+
+	notify := func(iface string) {
+		select {
+		case events <- iface:
+		default:
+		}
+	}
+
+	for ctx.Err() == nil {
+		msgs, err := w.conn.receive()
+		switch {
+		case errors.Is(err, syscall.EAGAIN), errors.Is(err, syscall.EWOULDBLOCK):
+			continue
+		case errors.Is(err, syscall.ENOBUFS):
+			// notifications were lost, so any interface may have changed
+			slog.Warn("Netlink notifications overflowed")
+			notify(w.interfaces[0])
+			continue
+		case err != nil:
+			slog.Error("Stopped watching netlink notifications, relying on polling only", "err", err)
+			return
+		}
+
+		for _, msg := range msgs {
+			iface := linkEventInterface(msg, interfaceNameByIndex)
+			if iface != "" && slices.Contains(w.interfaces, iface) {
+				slog.Debug("Received netlink notification", "interface", iface, "type", msg.Header.Type)
+				notify(iface)
+			}
+		}
+	}
+}
+
+// linkEventInterface returns the name of the interface a link or address notification refers to, or an empty string
+// for unrelated messages.
+func linkEventInterface(msg syscall.NetlinkMessage, nameByIndex func(int) string) string {
+	switch msg.Header.Type {
+	case syscall.RTM_NEWLINK, syscall.RTM_DELLINK:
+		attrs, err := syscall.ParseNetlinkRouteAttr(&msg)
+		if err != nil {
+			return ""
+		}
+		for _, attr := range attrs {
+			if attr.Attr.Type == syscall.IFLA_IFNAME {
+				return strings.TrimRight(string(attr.Value), "\x00")
+			}
+		}
+		if len(msg.Data) >= syscall.SizeofIfInfomsg {
+			return nameByIndex(int(int32(binary.NativeEndian.Uint32(msg.Data[4:8])))) //nolint:gosec
+		}
+	case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+		if len(msg.Data) >= syscall.SizeofIfAddrmsg {
+			return nameByIndex(int(binary.NativeEndian.Uint32(msg.Data[4:8])))
+		}
+	}
+
+	return ""
+}
+
+func interfaceNameByIndex(index int) string {
+	iface, err := net.InterfaceByIndex(index)
+	if err != nil {
+		return ""
+	}
+
+	return iface.Name
+}
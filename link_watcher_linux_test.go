@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/binary"
+	"syscall"
+	"testing"
+)
+
+func testLinkMessage(msgType uint16, index int32, name string) syscall.NetlinkMessage {
+	data := make([]byte, syscall.SizeofIfInfomsg)
+	binary.NativeEndian.PutUint32(data[4:8], uint32(index)) //nolint:gosec
+	if name != "" {
+		data = append(data, encodeNlAttrString(syscall.IFLA_IFNAME, name)...)
+	}
+
+	return syscall.NetlinkMessage{
+		Header: syscall.NlMsghdr{Type: msgType, Len: uint32(syscall.NLMSG_HDRLEN + len(data))}, //nolint:gosec
+		Data:   data,
+	}
+}
+
+func testAddrMessage(msgType uint16, index uint32) syscall.NetlinkMessage {
+	data := make([]byte, syscall.SizeofIfAddrmsg)
+	binary.NativeEndian.PutUint32(data[4:8], index)
+
+	return syscall.NetlinkMessage{
+		Header: syscall.NlMsghdr{Type: msgType, Len: uint32(syscall.NLMSG_HDRLEN + len(data))}, //nolint:gosec
+		Data:   data,
+	}
+}
+
+func Test_linkEventInterface(t *testing.T) {
+	nameByIndex := func(index int) string {
+		if index == 7 {
+			return "wg0"
+		}
+		return ""
+	}
+
+	tests := []struct {
+		name string
+		msg  syscall.NetlinkMessage
+		want string
+	}{
+		{
+			name: "new link with name",
+			msg:  testLinkMessage(syscall.RTM_NEWLINK, 3, "wg1"),
+			want: "wg1",
+		},
+		{
+			name: "deleted link with name",
+			msg:  testLinkMessage(syscall.RTM_DELLINK, 3, "wg1"),
+			want: "wg1",
+		},
+		{
+			name: "link without name attribute",
+			msg:  testLinkMessage(syscall.RTM_NEWLINK, 7, ""),
+			want: "wg0",
+		},
+		{
+			name: "new address",
+			msg:  testAddrMessage(syscall.RTM_NEWADDR, 7),
+			want: "wg0",
+		},
+		{
+			name: "deleted address of unknown interface",
+			msg:  testAddrMessage(syscall.RTM_DELADDR, 42),
+			want: "",
+		},
+		{
+			name: "unrelated message",
+			msg:  testAddrMessage(syscall.RTM_NEWROUTE, 7),
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := linkEventInterface(tt.msg, nameByIndex); got != tt.want {
+				t.Errorf("linkEventInterface() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
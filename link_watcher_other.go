@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+type LinkWatcher struct{}
+
+func NewLinkWatcher(_ []string) (*LinkWatcher, error) {
+	return nil, errors.New("watching netlink notifications is only supported on linux")
+}
+
+func (w *LinkWatcher) Watch(_ context.Context, _ chan<- string) {}
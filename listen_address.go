@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const rdomainKeyword = "rdomain"
+
+// ListenAddress represents the argument of an sshd ListenAddress directive: 'host', 'host:port', '[host]:port',
+// optionally followed by 'rdomain <name>'.
+type ListenAddress struct {
+	Host    net.IP
+	Port    int
+	RDomain string
+}
+
+func ParseListenAddress(addr string) (ListenAddress, error) {
+	fields := strings.Fields(addr)
+	if len(fields) == 0 {
+		return ListenAddress{}, errors.New("empty address")
+	}
+
+	var ret ListenAddress
+	switch len(fields) {
+	case 1:
+	case 3:
+		if fields[1] != rdomainKeyword {
+			return ListenAddress{}, fmt.Errorf("expected %q, got %q", rdomainKeyword, fields[1])
+		}
+		ret.RDomain = fields[2]
+	default:
+		return ListenAddress{}, fmt.Errorf("expected 'host[:port] [rdomain name]', got %q", addr)
+	}
+
+	host := fields[0]
+	port := ""
+	switch {
+	case strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]"):
+		host = host[1 : len(host)-1]
+	case strings.HasPrefix(host, "["), strings.Count(host, ":") == 1:
+		var err error
+		host, port, err = net.SplitHostPort(host)
+		if err != nil {
+			return ListenAddress{}, fmt.Errorf("invalid address %q: %w", fields[0], err)
+		}
+	}
+
+	ret.Host = net.ParseIP(host)
+	if ret.Host == nil {
+		return ListenAddress{}, fmt.Errorf("invalid ip %q", host)
+	}
+
+	if port != "" {
+		parsed, err := strconv.Atoi(port)
+		if err != nil || parsed < 1 || parsed > 65535 {
+			return ListenAddress{}, fmt.Errorf("invalid port %q", port)
+		}
+		ret.Port = parsed
+	}
+
+	return ret, nil
+}
+
+// String returns the canonical representation as understood by sshd.
+func (l ListenAddress) String() string {
+	ret := l.Host.String()
+	if l.Port > 0 {
+		ret = net.JoinHostPort(ret, strconv.Itoa(l.Port))
+	}
+
+	if l.RDomain != "" {
+		ret = fmt.Sprintf("%s %s %s", ret, rdomainKeyword, l.RDomain)
+	}
+
+	return ret
+}
+
+// normalizeListenAddress returns the canonical representation of addr, or addr itself if it can not be parsed.
+func normalizeListenAddress(addr string) string {
+	parsed, err := ParseListenAddress(addr)
+	if err != nil {
+		return strings.Join(strings.Fields(addr), " ")
+	}
+
+	return parsed.String()
+}
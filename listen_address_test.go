@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestParseListenAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{name: "ipv4", addr: "10.8.0.1", want: "10.8.0.1"},
+		{name: "ipv6", addr: "::", want: "::"},
+		{name: "ipv6 in brackets", addr: "[fd00::1]", want: "fd00::1"},
+		{name: "ipv4 with port", addr: "10.8.0.1:2222", want: "10.8.0.1:2222"},
+		{name: "ipv6 with port", addr: "[::1]:2222", want: "[::1]:2222"},
+		{name: "ipv6 not canonical", addr: "fd00:0::0:1", want: "fd00::1"},
+		{name: "rdomain", addr: "0.0.0.0 rdomain vrf0", want: "0.0.0.0 rdomain vrf0"},
+		{name: "port and rdomain", addr: "[::]:22  rdomain  vrf0", want: "[::]:22 rdomain vrf0"},
+		{name: "empty", addr: "", wantErr: true},
+		{name: "invalid ip", addr: "127.0.0.0.1", wantErr: true},
+		{name: "hostname", addr: "localhost", wantErr: true},
+		{name: "invalid port", addr: "10.8.0.1:ssh", wantErr: true},
+		{name: "port out of range", addr: "10.8.0.1:65536", wantErr: true},
+		{name: "ipv6 with port without brackets", addr: "[::1:22", wantErr: true},
+		{name: "rdomain missing name", addr: "10.8.0.1 rdomain", wantErr: true},
+		{name: "garbage after address", addr: "10.8.0.1 foo bar", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseListenAddress(tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseListenAddress() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("ParseListenAddress() = %v, want %v", got.String(), tt.want)
+			}
+		})
+	}
+}
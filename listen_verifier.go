@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	procRoot = "/proc"
+
+	// tcpStateListen is TCP_LISTEN as printed in /proc/net/tcp
+	tcpStateListen = "0A"
+	// tcpStateEstablished is TCP_ESTABLISHED as printed in /proc/net/tcp
+	tcpStateEstablished = "01"
+
+	defaultSshPort = 22
+)
+
+type mainPidProvider interface {
+	MainPid() (int, error)
+}
+
+// listenSocket is an address and port sshd is expected to listen on.
+type listenSocket struct {
+	ip   net.IP
+	port int
+}
+
+func (l listenSocket) String() string {
+	return net.JoinHostPort(l.ip.String(), strconv.Itoa(l.port))
+}
+
+// ProcNetVerifier verifies that the main sshd process listens on the configured addresses by matching its socket
+// inodes against the listening sockets in /proc/<pid>/net/tcp and /proc/<pid>/net/tcp6.
+type ProcNetVerifier struct {
+	pids           mainPidProvider
+	sshdConfigFile string
+	procRoot       string
+	retries        int
+	interval       time.Duration
+}
+
+func NewProcNetVerifier(pids mainPidProvider, sshdConfigFile string, retries int, interval time.Duration) (*ProcNetVerifier, error) {
+	if pids == nil {
+		return nil, errors.New("no main pid provider provided")
+	}
+
+	if sshdConfigFile == "" {
+		return nil, errors.New("empty sshd config file provided")
+	}
+
+	if retries < 0 {
+		return nil, errors.New("retries must not be negative")
+	}
+
+	return &ProcNetVerifier{
+		pids:           pids,
+		sshdConfigFile: sshdConfigFile,
+		procRoot:       procRoot,
+		retries:        retries,
+		interval:       interval,
+	}, nil
+}
+
+// VerifyListening returns an error if sshd does not listen on all given addresses after the configured number of
+// retries. Addresses without a port are expected on all ports configured using the Port directive.
+func (v *ProcNetVerifier) VerifyListening(addresses []string) error {
+	expected, err := expectedSockets(v.sshdConfigFile, addresses)
+	if err != nil {
+		return err
+	}
+
+	var missing []listenSocket
+	for attempt := 0; attempt <= v.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(v.interval)
+		}
+
+		var listening []listenSocket
+		listening, err = v.listeningSockets()
+		if err != nil {
+			continue
+		}
+
+		missing = slices.DeleteFunc(slices.Clone(expected), func(socket listenSocket) bool {
+			return slices.ContainsFunc(listening, func(l listenSocket) bool {
+				return l.port == socket.port && l.ip.Equal(socket.ip)
+			})
+		})
+		if len(missing) == 0 {
+			return nil
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not read listening sockets of sshd: %w", err)
+	}
+	return fmt.Errorf("sshd is not listening on %v", missing)
+}
+
+// expectedSockets returns the sockets sshd is expected to listen on for the given addresses.
+func expectedSockets(sshdConfigFile string, addresses []string) ([]listenSocket, error) {
+	lines, err := loadSshdConfig(sshdConfigFile, sshdIncludeDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read sshd config: %w", err)
+	}
+	ports := configuredPorts(lines)
+
+	var expected []listenSocket
+	for _, addr := range addresses {
+		parsed, err := ParseListenAddress(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if parsed.Port != 0 {
+			expected = append(expected, listenSocket{ip: parsed.Host, port: parsed.Port})
+			continue
+		}
+		for _, port := range ports {
+			expected = append(expected, listenSocket{ip: parsed.Host, port: port})
+		}
+	}
+
+	return expected, nil
+}
+
+// configuredPorts returns the ports of all Port directives outside of Match blocks or sshd's default port.
+func configuredPorts(lines []sshdConfigLine) []int {
+	var ports []int
+	for _, line := range lines {
+		if line.Keyword != sshdKeywordPort || line.InMatch || len(line.Args) == 0 {
+			continue
+		}
+		if port, err := strconv.Atoi(line.Args[0]); err == nil && !slices.Contains(ports, port) {
+			ports = append(ports, port)
+		}
+	}
+
+	if len(ports) == 0 {
+		return []int{defaultSshPort}
+	}
+	return ports
+}
+
+func (v *ProcNetVerifier) listeningSockets() ([]listenSocket, error) {
+	pid, err := v.pids.MainPid()
+	if err != nil {
+		return nil, err
+	}
+
+	pidDir := filepath.Join(v.procRoot, strconv.Itoa(pid))
+	inodes, err := socketInodes(filepath.Join(pidDir, "fd"))
+	if err != nil {
+		return nil, err
+	}
+
+	var listening []listenSocket
+	for _, file := range []string{"tcp", "tcp6"} {
+		sockets, err := readProcNetTcp(filepath.Join(pidDir, "net", file))
+		if err != nil {
+			return nil, err
+		}
+		for _, socket := range sockets {
+			if socket.state == tcpStateListen && slices.Contains(inodes, socket.inode) {
+				listening = append(listening, socket.local)
+			}
+		}
+	}
+
+	return listening, nil
+}
+
+// socketInodes returns the inodes of all sockets referenced by the file descriptors in the given directory.
+func socketInodes(fdDir string) ([]string, error) {
+	entries, err := os.ReadDir(fdDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var inodes []string
+	for _, entry := range entries {
+		target, err := os.Readlink(filepath.Join(fdDir, entry.Name()))
+		if err != nil {
+			// the file descriptor may have been closed in the meantime
+			continue
+		}
+		if inode, found := strings.CutPrefix(target, "socket:["); found {
+			inodes = append(inodes, strings.TrimSuffix(inode, "]"))
+		}
+	}
+
+	return inodes, nil
+}
+
+type procNetSocket struct {
+	local listenSocket
+	state string
+	inode string
+}
+
+func readProcNetTcp(file string) ([]procNetSocket, error) {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		// IPv6 may be disabled
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseProcNetTcp(f)
+}
+
+// parseProcNetTcp parses the format of /proc/net/tcp and /proc/net/tcp6.
+func parseProcNetTcp(r io.Reader) ([]procNetSocket, error) {
+	var sockets []procNetSocket
+	scanner := bufio.NewScanner(r)
+	// skip the header
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+
+		local, err := parseProcNetAddress(fields[1])
+		if err != nil {
+			return nil, err
+		}
+
+		sockets = append(sockets, procNetSocket{
+			local: local,
+			state: fields[3],
+			inode: fields[9],
+		})
+	}
+
+	return sockets, scanner.Err()
+}
+
+// parseProcNetAddress parses addresses such as '0100007F:0016'. The address is printed as a sequence of 32-bit words
+// in host byte order, the port in network byte order.
+func parseProcNetAddress(addr string) (listenSocket, error) {
+	hexIP, hexPort, found := strings.Cut(addr, ":")
+	if !found {
+		return listenSocket{}, fmt.Errorf("invalid address %q", addr)
+	}
+
+	ip, err := hex.DecodeString(hexIP)
+	if err != nil || (len(ip) != net.IPv4len && len(ip) != net.IPv6len) {
+		return listenSocket{}, fmt.Errorf("invalid address %q", addr)
+	}
+	for i := 0; i < len(ip); i += 4 {
+		binary.NativeEndian.PutUint32(ip[i:], binary.BigEndian.Uint32(ip[i:]))
+	}
+
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return listenSocket{}, fmt.Errorf("invalid port in address %q: %w", addr, err)
+	}
+
+	return listenSocket{ip: ip, port: int(port)}, nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testProcNetTcp = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:BC8F 00000000:0000 0A 00000000:00000000 00:00000000 00000000 65534        0 911 1 0000000035df3ddc 100 0 0 10 0
+   1: 0100080A:08AE 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 4242 1 00000000fbcccd1b 100 0 0 10 0
+   2: 0100080A:08AE 0200080A:D431 01 00000000:00000000 00:00000000 00000000     0        0 4343 1 00000000fbcccd1b 100 0 0 10 0
+`
+
+const testProcNetTcp6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 000000FD000000000000000001000000:08AE 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 4444 1 0000000000000000 100 0 0 10 0
+`
+
+type dummyPidProvider struct {
+	pid int
+	err error
+}
+
+func (d *dummyPidProvider) MainPid() (int, error) {
+	return d.pid, d.err
+}
+
+func skipOnBigEndian(t *testing.T) {
+	t.Helper()
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("test data is in little endian byte order")
+	}
+}
+
+func Test_parseProcNetAddress(t *testing.T) {
+	skipOnBigEndian(t)
+
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{addr: "0100007F:0016", want: "127.0.0.1:22"},
+		{addr: "00000000:08AE", want: "0.0.0.0:2222"},
+		{addr: "000000FD000000000000000001000000:0016", want: "[fd00::1]:22"},
+		{addr: "00000000000000000000000000000000:0016", want: "[::]:22"},
+		{addr: "0100007F", wantErr: true},
+		{addr: "0100007F00:0016", wantErr: true},
+		{addr: "0100007F:XYZ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			got, err := parseProcNetAddress(tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseProcNetAddress() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("parseProcNetAddress() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseProcNetTcp(t *testing.T) {
+	skipOnBigEndian(t)
+
+	got, err := parseProcNetTcp(strings.NewReader(testProcNetTcp))
+	if err != nil {
+		t.Fatalf("parseProcNetTcp() error = %v", err)
+	}
+
+	var formatted []string
+	for _, socket := range got {
+		formatted = append(formatted, fmt.Sprintf("%s %s %s", socket.local, socket.state, socket.inode))
+	}
+	want := []string{"127.0.0.1:48271 0A 911", "10.8.0.1:2222 0A 4242", "10.8.0.1:2222 01 4343"}
+	if !reflect.DeepEqual(formatted, want) {
+		t.Errorf("parseProcNetTcp() got = %v, want %v", formatted, want)
+	}
+}
+
+func Test_configuredPorts(t *testing.T) {
+	tests := []struct {
+		name   string
+		config []string
+		want   []int
+	}{
+		{
+			name:   "default port",
+			config: []string{"PermitRootLogin no"},
+			want:   []int{22},
+		},
+		{
+			name:   "multiple ports",
+			config: []string{"Port 22", "port 2222", "Port 22"},
+			want:   []int{22, 2222},
+		},
+		{
+			name:   "port in match block ignored",
+			config: []string{"Port 2222", "Match User git", "Port 22"},
+			want:   []int{2222},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := configuredPorts(parseSshdConfig("", tt.config)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("configuredPorts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcNetVerifier_VerifyListening(t *testing.T) {
+	skipOnBigEndian(t)
+
+	tests := []struct {
+		name      string
+		addresses []string
+		pidErr    error
+		wantErr   bool
+	}{
+		{
+			name:      "listening on configured port",
+			addresses: []string{"10.8.0.1"},
+		},
+		{
+			name:      "listening on explicit port",
+			addresses: []string{"10.8.0.1:2222", "[fd00::1]:2222"},
+		},
+		{
+			name:      "socket of other process",
+			addresses: []string{"127.0.0.1:48271"},
+			wantErr:   true,
+		},
+		{
+			name:      "not listening",
+			addresses: []string{"10.9.0.1"},
+			wantErr:   true,
+		},
+		{
+			name:      "established connection only",
+			addresses: []string{"10.8.0.1:22"},
+			wantErr:   true,
+		},
+		{
+			name:      "sshd not running",
+			addresses: []string{"10.8.0.1"},
+			pidErr:    errors.New("no main process"),
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFile(t, filepath.Join(dir, "sshd_config"), "Port 2222\n")
+			writeTestFile(t, filepath.Join(dir, "proc", "42", "net", "tcp"), testProcNetTcp)
+			writeTestFile(t, filepath.Join(dir, "proc", "42", "net", "tcp6"), testProcNetTcp6)
+			fdDir := filepath.Join(dir, "proc", "42", "fd")
+			if err := os.MkdirAll(fdDir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			for fd, target := range map[string]string{"0": "/dev/null", "3": "socket:[4242]", "4": "socket:[4343]", "5": "socket:[4444]"} {
+				if err := os.Symlink(target, filepath.Join(fdDir, fd)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			v, err := NewProcNetVerifier(&dummyPidProvider{pid: 42, err: tt.pidErr}, filepath.Join(dir, "sshd_config"), 1, time.Millisecond)
+			if err != nil {
+				t.Fatalf("NewProcNetVerifier() error = %v", err)
+			}
+			v.procRoot = filepath.Join(dir, "proc")
+
+			if err := v.VerifyListening(tt.addresses); (err != nil) != tt.wantErr {
+				t.Errorf("VerifyListening() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProcNetVerifier_VerifyListeningProc(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	configFile := filepath.Join(t.TempDir(), "sshd_config")
+	writeTestFile(t, configFile, fmt.Sprintf("Port %d\n", port))
+
+	v, err := NewProcNetVerifier(&dummyPidProvider{pid: os.Getpid()}, configFile, 0, time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewProcNetVerifier() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(v.procRoot, "self", "net", "tcp")); err != nil {
+		t.Skipf("procfs not available: %v", err)
+	}
+
+	if err := v.VerifyListening([]string{"127.0.0.1"}); err != nil {
+		t.Errorf("VerifyListening() error = %v", err)
+	}
+	if err := v.VerifyListening([]string{"127.0.0.2"}); err == nil {
+		t.Errorf("VerifyListening() expected error for address not listened on")
+	}
+}
+
+func writeTestFile(t *testing.T, file string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
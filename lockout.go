@@ -0,0 +1,304 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+type lockoutVerdict int
+
+const (
+	lockoutPending lockoutVerdict = iota
+	lockoutConfirmed
+	lockoutExpired
+)
+
+// connectionSampleInterval is the interval connections are sampled at, so short logins between checks are not missed.
+const connectionSampleInterval = time.Second
+
+// reachabilityCheck looks for evidence that sshd can be reached on the addresses it has been switched to.
+type reachabilityCheck interface {
+	// start is called right after switching to the given addresses.
+	start(addresses []string) error
+	// reachable reports whether there is evidence of sshd being reachable since start has been called.
+	reachable() (bool, error)
+	// stop releases resources acquired by start, once no more evidence is needed.
+	stop()
+	String() string
+}
+
+// connectionCheck considers sshd reachable once a new inbound connection to one of its addresses has been established.
+// Connections that already existed when switching addresses are disregarded, as they survive restarting sshd.
+// Connections are sampled in the background between checks, so logins that ended before the next check count as well.
+type connectionCheck struct {
+	sshdConfigFile string
+	procRoot       string
+	interval       time.Duration
+
+	mu       sync.Mutex
+	expected []listenSocket
+	known    []string
+	seen     bool
+	done     chan struct{}
+}
+
+func (c *connectionCheck) start(addresses []string) error {
+	c.stop()
+
+	expected, err := expectedSockets(c.sshdConfigFile, addresses)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expected = expected
+	c.seen = false
+	c.known, err = c.connections()
+	if err != nil {
+		return err
+	}
+
+	if c.interval > 0 {
+		c.done = make(chan struct{})
+		go c.sampleUntilDone(c.done)
+	}
+	return nil
+}
+
+func (c *connectionCheck) sampleUntilDone(done <-chan struct{}) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if reachable, err := c.sample(); err != nil {
+				slog.Debug("Could not sample connections", "err", err)
+			} else if reachable {
+				return
+			}
+		}
+	}
+}
+
+func (c *connectionCheck) reachable() (bool, error) {
+	return c.sample()
+}
+
+// sample looks for new connections and returns whether any new connection has been seen since start has been called.
+func (c *connectionCheck) sample() (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.seen {
+		return true, nil
+	}
+
+	connections, err := c.connections()
+	if err != nil {
+		return false, err
+	}
+
+	c.seen = slices.ContainsFunc(connections, func(inode string) bool {
+		return !slices.Contains(c.known, inode)
+	})
+	return c.seen, nil
+}
+
+func (c *connectionCheck) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.done != nil {
+		close(c.done)
+		c.done = nil
+	}
+}
+
+// connections returns the inodes of all established connections to one of the expected sockets.
+func (c *connectionCheck) connections() ([]string, error) {
+	var inodes []string
+	for _, file := range []string{"tcp", "tcp6"} {
+		sockets, err := readProcNetTcp(filepath.Join(c.procRoot, "net", file))
+		if err != nil {
+			return nil, err
+		}
+		for _, socket := range sockets {
+			if socket.state != tcpStateEstablished {
+				continue
+			}
+			if slices.ContainsFunc(c.expected, func(l listenSocket) bool {
+				return l.port == socket.local.port && l.ip.Equal(socket.local.ip)
+			}) {
+				inodes = append(inodes, socket.inode)
+			}
+		}
+	}
+
+	return inodes, nil
+}
+
+func (c *connectionCheck) String() string {
+	return "inbound connection"
+}
+
+// probeCheck considers sshd reachable once any of the targets can be probed successfully.
+type probeCheck struct {
+	probers []prober
+	timeout time.Duration
+}
+
+func (c *probeCheck) start(_ []string) error {
+	return nil
+}
+
+func (c *probeCheck) stop() {}
+
+func (c *probeCheck) reachable() (bool, error) {
+	var errs []error
+	for _, p := range c.probers {
+		err := p.probe(c.timeout)
+		if err == nil {
+			return true, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", p, err))
+	}
+
+	slog.Debug("No probe target reachable", "err", errors.Join(errs...))
+	return false, nil
+}
+
+func (c *probeCheck) String() string {
+	return "probe"
+}
+
+// confirmFileCheck considers sshd reachable once the file has been modified after switching addresses, e.g. by an
+// admin running 'touch' after logging in.
+type confirmFileCheck struct {
+	file  string
+	since time.Time
+}
+
+func (c *confirmFileCheck) start(_ []string) error {
+	c.since = time.Now()
+	return nil
+}
+
+func (c *confirmFileCheck) stop() {}
+
+func (c *confirmFileCheck) reachable() (bool, error) {
+	info, err := os.Stat(c.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return !info.ModTime().Before(c.since), nil
+}
+
+func (c *confirmFileCheck) String() string {
+	return "confirmation file"
+}
+
+// LockoutWatchdog requires evidence of sshd being reachable within a timeout after switching to the addresses for
+// status up.
+type LockoutWatchdog struct {
+	checks  []reachabilityCheck
+	timeout time.Duration
+	now     func() time.Time
+
+	addresses []string
+	deadline  time.Time
+	confirmed bool
+}
+
+func NewLockoutWatchdog(timeout time.Duration, checks ...reachabilityCheck) (*LockoutWatchdog, error) {
+	if timeout <= 0 {
+		return nil, errors.New("lockout timeout must be positive")
+	}
+
+	if len(checks) == 0 {
+		return nil, errors.New("no reachability checks provided")
+	}
+
+	return &LockoutWatchdog{
+		checks:  checks,
+		timeout: timeout,
+		now:     time.Now,
+	}, nil
+}
+
+// arm starts waiting for evidence of sshd being reachable on the given addresses. Arming the watchdog again for the
+// same addresses neither extends the deadline nor requires new evidence.
+func (w *LockoutWatchdog) arm(addresses []string) {
+	if w.addresses != nil && sameListenAddresses(w.addresses, addresses) {
+		return
+	}
+
+	w.addresses = addresses
+	w.deadline = w.now().Add(w.timeout)
+	w.confirmed = false
+	for _, check := range w.checks {
+		if err := check.start(addresses); err != nil {
+			slog.Warn("Could not start reachability check", "check", check, "err", err)
+		}
+	}
+	slog.Info("Waiting for evidence of ssh being reachable", "addresses", addresses, "deadline", w.deadline)
+}
+
+// restore marks the given addresses as confirmed reachable, as a previous run already found evidence for them.
+func (w *LockoutWatchdog) restore(addresses []string) {
+	w.addresses = addresses
+	w.confirmed = true
+}
+
+func (w *LockoutWatchdog) disarm() {
+	w.addresses = nil
+	w.confirmed = false
+	w.stopChecks()
+}
+
+func (w *LockoutWatchdog) stopChecks() {
+	for _, check := range w.checks {
+		check.stop()
+	}
+}
+
+func (w *LockoutWatchdog) armed() bool {
+	return w.addresses != nil && !w.confirmed
+}
+
+// observe looks for evidence of sshd being reachable. The deadline is only checked if no evidence has been found.
+func (w *LockoutWatchdog) observe() lockoutVerdict {
+	for _, check := range w.checks {
+		reachable, err := check.reachable()
+		if err != nil {
+			slog.Warn("Could not check reachability", "check", check, "err", err)
+			continue
+		}
+		if reachable {
+			slog.Info("Confirmed ssh is reachable", "addresses", w.addresses, "evidence", check)
+			w.confirmed = true
+			w.stopChecks()
+			return lockoutConfirmed
+		}
+	}
+
+	if w.now().Before(w.deadline) {
+		return lockoutPending
+	}
+
+	w.disarm()
+	return lockoutExpired
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testProcNetTcpEstablished = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100080A:08AE 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 4242 1 00000000fbcccd1b 100 0 0 10 0
+   1: 0100080A:08AE 0200080A:D431 01 00000000:00000000 00:00000000 00000000     0        0 4343 1 00000000fbcccd1b 100 0 0 10 0
+`
+
+func Test_connectionCheck(t *testing.T) {
+	skipOnBigEndian(t)
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "sshd_config"), "Port 2222\n")
+	tcpFile := filepath.Join(dir, "proc", "net", "tcp")
+	writeTestFile(t, tcpFile, testProcNetTcpEstablished)
+
+	check := &connectionCheck{sshdConfigFile: filepath.Join(dir, "sshd_config"), procRoot: filepath.Join(dir, "proc")}
+	if err := check.start([]string{"10.8.0.1"}); err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+
+	if reachable, err := check.reachable(); err != nil || reachable {
+		t.Errorf("reachable() with connection established before start = %v, %v, want false, nil", reachable, err)
+	}
+
+	// a new connection to another address
+	writeTestFile(t, tcpFile, testProcNetTcpEstablished+
+		"   2: 0100090A:08AE 0200080A:D432 01 00000000:00000000 00:00000000 00000000     0        0 4545 1 00000000fbcccd1b 100 0 0 10 0\n")
+	if reachable, err := check.reachable(); err != nil || reachable {
+		t.Errorf("reachable() with connection to other address = %v, %v, want false, nil", reachable, err)
+	}
+
+	writeTestFile(t, tcpFile, testProcNetTcpEstablished+
+		"   2: 0100080A:08AE 0200080A:D432 01 00000000:00000000 00:00000000 00000000     0        0 4646 1 00000000fbcccd1b 100 0 0 10 0\n")
+	if reachable, err := check.reachable(); err != nil || !reachable {
+		t.Errorf("reachable() with new connection = %v, %v, want true, nil", reachable, err)
+	}
+
+	// a connection seen once counts even after it has been closed
+	writeTestFile(t, tcpFile, testProcNetTcpEstablished)
+	if reachable, err := check.reachable(); err != nil || !reachable {
+		t.Errorf("reachable() after new connection closed = %v, %v, want true, nil", reachable, err)
+	}
+
+	if err := check.start([]string{"10.8.0.1"}); err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+	if reachable, err := check.reachable(); err != nil || reachable {
+		t.Errorf("reachable() after starting again = %v, %v, want false, nil", reachable, err)
+	}
+}
+
+func Test_connectionCheckSampling(t *testing.T) {
+	skipOnBigEndian(t)
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "sshd_config"), "Port 2222\n")
+	tcpFile := filepath.Join(dir, "proc", "net", "tcp")
+	writeTestFile(t, tcpFile, testProcNetTcpEstablished)
+
+	check := &connectionCheck{sshdConfigFile: filepath.Join(dir, "sshd_config"), procRoot: filepath.Join(dir, "proc"), interval: time.Millisecond}
+	if err := check.start([]string{"10.8.0.1"}); err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+	t.Cleanup(check.stop)
+
+	// a short login between two checks
+	writeTestFile(t, tcpFile, testProcNetTcpEstablished+
+		"   2: 0100080A:08AE 0200080A:D432 01 00000000:00000000 00:00000000 00000000     0        0 4646 1 00000000fbcccd1b 100 0 0 10 0\n")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		check.mu.Lock()
+		seen := check.seen
+		check.mu.Unlock()
+		if seen {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("connection has not been sampled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	writeTestFile(t, tcpFile, testProcNetTcpEstablished)
+
+	if reachable, err := check.reachable(); err != nil || !reachable {
+		t.Errorf("reachable() after short login = %v, %v, want true, nil", reachable, err)
+	}
+}
+
+func Test_confirmFileCheck(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "confirm")
+	check := &confirmFileCheck{file: file}
+	if err := check.start(nil); err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+
+	if reachable, err := check.reachable(); err != nil || reachable {
+		t.Errorf("reachable() without file = %v, %v, want false, nil", reachable, err)
+	}
+
+	writeTestFile(t, file, "")
+	past := check.since.Add(-time.Hour)
+	if err := os.Chtimes(file, past, past); err != nil {
+		t.Fatal(err)
+	}
+	if reachable, err := check.reachable(); err != nil || reachable {
+		t.Errorf("reachable() with file touched before start = %v, %v, want false, nil", reachable, err)
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(file, now, now); err != nil {
+		t.Fatal(err)
+	}
+	if reachable, err := check.reachable(); err != nil || !reachable {
+		t.Errorf("reachable() with file touched after start = %v, %v, want true, nil", reachable, err)
+	}
+}
+
+type dummyReachabilityCheck struct {
+	isReachable bool
+	starts      int
+	stops       int
+}
+
+func (d *dummyReachabilityCheck) start(_ []string) error {
+	d.starts++
+	return nil
+}
+
+func (d *dummyReachabilityCheck) reachable() (bool, error) {
+	return d.isReachable, nil
+}
+
+func (d *dummyReachabilityCheck) stop() {
+	d.stops++
+}
+
+func (d *dummyReachabilityCheck) String() string {
+	return "dummy"
+}
+
+func TestLockoutWatchdog(t *testing.T) {
+	check := &dummyReachabilityCheck{}
+	w, err := NewLockoutWatchdog(time.Minute, check)
+	if err != nil {
+		t.Fatalf("NewLockoutWatchdog() error = %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	w.now = func() time.Time { return now }
+
+	if w.armed() {
+		t.Fatalf("armed() = true before arming")
+	}
+
+	w.arm([]string{"10.8.0.1"})
+	if got := w.observe(); got != lockoutPending {
+		t.Errorf("observe() = %v, want pending", got)
+	}
+
+	// arming for the same addresses does not extend the deadline
+	now = now.Add(30 * time.Second)
+	w.arm([]string{"10.8.0.1"})
+	if check.starts != 1 {
+		t.Errorf("arm() started checks %d times, want 1", check.starts)
+	}
+
+	now = now.Add(30 * time.Second)
+	if got := w.observe(); got != lockoutExpired {
+		t.Errorf("observe() = %v, want expired", got)
+	}
+	if w.armed() {
+		t.Errorf("armed() = true after expiring")
+	}
+
+	w.arm([]string{"10.8.0.1"})
+	check.isReachable = true
+	if got := w.observe(); got != lockoutConfirmed {
+		t.Errorf("observe() = %v, want confirmed", got)
+	}
+	if w.armed() {
+		t.Errorf("armed() = true after confirming")
+	}
+	if check.stops != 2 {
+		t.Errorf("checks stopped %d times, want 2", check.stops)
+	}
+
+	if _, err := NewLockoutWatchdog(0, check); err == nil {
+		t.Errorf("NewLockoutWatchdog() expected error for zero timeout")
+	}
+	if _, err := NewLockoutWatchdog(time.Minute); err == nil {
+		t.Errorf("NewLockoutWatchdog() expected error without checks")
+	}
+}
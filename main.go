@@ -4,9 +4,11 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"syscall"
@@ -15,11 +17,22 @@ import (
 
 const (
 	defaultConfigFile = "/etc/ssh-aegis.json"
+
+	listenVerifyInterval = time.Second
+
+	commandPlan  = "plan"
+	commandApply = "apply"
+
+	exitCodeOk    = 0
+	exitCodeError = 1
+	// exitCodeChangesPending signals that the sshd config does not match the current status
+	exitCodeChangesPending = 2
 )
 
 var (
 	flagConfigFile   string
 	flagDebug        bool
+	flagDryRun       bool
 	flagPrintVersion bool
 
 	BuildVersion string
@@ -30,6 +43,7 @@ var (
 func parseFlags() {
 	flag.StringVar(&flagConfigFile, "config", defaultConfigFile, "Path of config file")
 	flag.BoolVar(&flagDebug, "debug", false, "Print debug logs")
+	flag.BoolVar(&flagDryRun, "dry-run", false, "Print the changes for the current status without applying them and exit, same as the 'plan' command")
 	flag.BoolVar(&flagPrintVersion, "version", false, "Print version and exit")
 	flag.Parse()
 }
@@ -43,7 +57,28 @@ func main() {
 		os.Exit(0)
 	}
 
-	setupLogging()
+	command := flag.Arg(0)
+	var forcedStatus *TunnelStatus
+	switch command {
+	case "":
+	case commandApply, commandPlan:
+		var err error
+		forcedStatus, err = parseCommandFlags(command, flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown command %q", command)
+	}
+	dryRun := flagDryRun || command == commandPlan
+
+	// the plan is printed to stdout, keep it free of logs
+	logOutput := os.Stdout
+	if dryRun {
+		logOutput = os.Stderr
+	}
+	setupLogging(logOutput)
+
 	slog.Info("Starting ssh-aegis", "version", BuildVersion, "go", GoVersion)
 	slog.Info("Reading config", "file", flagConfigFile)
 	config, err := readConfig(flagConfigFile)
@@ -57,18 +92,30 @@ func main() {
 	}
 	config.printConfig()
 
-	var statusSource TunnelStatusSource = &WgStatus{interfaceName: config.WireguardInterface}
-	var serviceProvider ServiceReloader = &Systemd{}
+	if command == commandApply && !dryRun && config.LockoutTimeoutSeconds > 0 {
+		slog.Warn("One-shot runs do not wait for evidence of ssh being reachable, lockout protection requires a running daemon")
+	}
 
-	slog.Info("Checking if ssh service unit exists", "name", config.SshServiceName)
-	if err := serviceProvider.UnitExists(); err != nil {
-		log.Fatal("unit for ssh does not exist: ", err)
+	if forcedStatus != nil && !dryRun && config.DriftMode == driftModeRepair {
+		slog.Warn("A daemon running with drift mode 'repair' reverts the forced status on its next check", "status", *forcedStatus)
 	}
 
-	sshConfigWrapper := &SshConfigWrapper{config.SshdConfigFile}
-	ssh, err := NewSshAegis(sshConfigWrapper, statusSource, serviceProvider, config)
+	ssh, err := buildSshAegis(config, dryRun)
 	if err != nil {
-		log.Fatal("could not build app: ", err)
+		log.Fatal(err)
+	}
+
+	if dryRun {
+		os.Exit(plan(ssh, forcedStatus))
+	}
+
+	ssh.stateStore, err = buildStateStore(config)
+	if err != nil {
+		log.Fatal("could not build state store: ", err)
+	}
+
+	if err := ssh.RestoreState(); err != nil {
+		slog.Warn("Could not restore state, starting from scratch", "err", err)
 	}
 
 	metricsWriter, err := buildMetricsWriter(config)
@@ -76,7 +123,16 @@ func main() {
 		log.Fatal("could not build metrics writer: ", err)
 	}
 
+	if command == commandApply {
+		os.Exit(apply(ssh, metricsWriter, forcedStatus))
+	}
+
+	if err := ssh.SnapshotListenAddresses(); err != nil {
+		log.Fatal("could not save addresses to restore on exit: ", err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
+	reloadRequests := make(chan struct{}, 1)
 	go func() {
 		sigc := make(chan os.Signal, 1)
 		signal.Notify(sigc,
@@ -85,40 +141,357 @@ func main() {
 			syscall.SIGTERM,
 			syscall.SIGQUIT)
 
-		<-sigc
-		slog.Info("Received signal")
-		cancel()
+		for sig := range sigc {
+			slog.Info("Received signal", "signal", sig)
+			if sig == syscall.SIGHUP {
+				select {
+				case reloadRequests <- struct{}{}:
+				default:
+				}
+				continue
+			}
+
+			cancel()
+			return
+		}
 	}()
 
-	run(ctx, ssh, metricsWriter)
+	if config.MetricsListenAddress != "" {
+		metricsServer, err := NewMetricsServer(config.MetricsListenAddress)
+		if err != nil {
+			log.Fatal("could not build metrics server: ", err)
+		}
+		go metricsServer.Run(ctx)
+	}
+
+	var linkEvents chan string
+	watchedInterfaces := config.watchedInterfaces()
+	if config.NetlinkEvents && len(watchedInterfaces) > 0 {
+		linkEvents = make(chan string, 1)
+		watcher, err := NewLinkWatcher(watchedInterfaces)
+		if err != nil {
+			slog.Warn("Can not watch netlink notifications, relying on polling only", "err", err)
+		} else {
+			go watcher.Watch(ctx, linkEvents)
+		}
+	}
+
+	run(ctx, ssh, metricsWriter, time.Duration(config.CheckIntervalSeconds)*time.Second, linkEvents, reloadRequests)
 }
 
-func run(ctx context.Context, ssh *SshAegis, metricsWriter *MetricsWriter) {
+// parseCommandFlags parses the arguments of the apply and plan commands and returns the status to force, if any.
+func parseCommandFlags(command string, args []string) (*TunnelStatus, error) {
+	commandFlags := flag.NewFlagSet(command, flag.ContinueOnError)
+	forcedStatus := commandFlags.String("status", "", "Use the addresses for the given status (up, down, unknown) instead of checking the status")
+	if err := commandFlags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if commandFlags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments for command %s: %v", command, commandFlags.Args())
+	}
+
+	if *forcedStatus == "" {
+		return nil, nil
+	}
+
+	status, found := parseTunnelStatus(*forcedStatus)
+	if !found {
+		return nil, fmt.Errorf("invalid status %q, must be one of up, down, unknown", *forcedStatus)
+	}
+
+	return &status, nil
+}
+
+// readStatus returns the forced status if given, otherwise the current reading of the status source.
+func readStatus(ssh *SshAegis, forcedStatus *TunnelStatus) TunnelStatus {
+	if forcedStatus != nil {
+		slog.Info("Using forced status", "status", *forcedStatus)
+		return *forcedStatus
+	}
+
+	return ssh.ReadStatus()
+}
+
+// apply applies the addresses for the current or forced status once, writes the metrics and returns the exit code.
+func apply(ssh *SshAegis, metricsWriter *MetricsWriter, forcedStatus *TunnelStatus) int {
+	err := ssh.Apply(readStatus(ssh, forcedStatus))
+	if err != nil {
+		slog.Error("could not apply status", "err", err)
+	}
+
+	if metricsWriter != nil {
+		if err := metricsWriter.Dump(); err != nil {
+			slog.Warn("can not write metrics data", "err", err)
+		}
+	}
+
+	if err != nil {
+		return exitCodeError
+	}
+	return exitCodeOk
+}
+
+// plan prints the changes that would be applied for the current or forced status and returns the exit code.
+func plan(ssh *SshAegis, forcedStatus *TunnelStatus) int {
+	changesPending, err := ssh.Plan(readStatus(ssh, forcedStatus))
+	if err != nil {
+		slog.Error("could not plan changes", "err", err)
+		return exitCodeError
+	}
+
+	if changesPending {
+		return exitCodeChangesPending
+	}
+
+	slog.Info("No changes pending")
+	return exitCodeOk
+}
+
+func run(ctx context.Context, ssh *SshAegis, metricsWriter *MetricsWriter, checkInterval time.Duration, linkEvents <-chan string, reloadRequests <-chan struct{}) {
 	ssh.Check()
-	t := time.NewTicker(1 * time.Minute)
+	publishMetrics()
+	t := time.NewTicker(checkInterval)
 
 	silenceMetricsWriterWarnLogs := false
-
+	dumpMetrics := func() {
+		publishMetrics()
+		if metricsWriter != nil {
+			if err := metricsWriter.Dump(); err != nil && !silenceMetricsWriterWarnLogs {
+				silenceMetricsWriterWarnLogs = true
+				slog.Warn("can not write metrics data", "err", err)
+			} else {
+				silenceMetricsWriterWarnLogs = false
+			}
+		}
+	}
 	for {
 		select {
 		case <-t.C:
 			ssh.Check()
-			if metricsWriter != nil {
-				if err := metricsWriter.Dump(); err != nil && !silenceMetricsWriterWarnLogs {
-					silenceMetricsWriterWarnLogs = true
-					slog.Warn("can not write metrics data", "err", err)
-				} else {
-					silenceMetricsWriterWarnLogs = false
-				}
-			}
+			dumpMetrics()
+		case iface := <-linkEvents:
+			slog.Info("Interface changed, checking status", "interface", iface)
+			ssh.CheckOnEvent()
+			dumpMetrics()
+		case <-reloadRequests:
+			reloadConfig(ssh, flagConfigFile)
+			dumpMetrics()
 		case <-ctx.Done():
 			t.Stop()
+			if err := ssh.Shutdown(); err != nil {
+				slog.Error("could not restore addresses on exit", "err", err)
+			}
+			dumpMetrics()
 			slog.Info("Bye")
 			return
 		}
 	}
 }
 
+// reloadConfig reads and validates the config file and applies it to the running instance. If the config can not be
+// read or is invalid, the running instance keeps using its current config.
+func reloadConfig(ssh *SshAegis, configFile string) {
+	slog.Info("Reloading config", "file", configFile)
+	config, err := readConfig(configFile)
+	if err == nil {
+		err = config.Validate()
+	}
+	if err == nil {
+		err = ssh.verifyReloadable(config)
+	}
+
+	if err != nil {
+		metrics.ConfigReloadErrors++
+		slog.Error("could not reload config, keeping current config", "err", err)
+		return
+	}
+
+	config.printConfig()
+	slog.Warn("Only addresses, rules, transition thresholds, drift mode and shutdown addresses are reloaded, other settings require a restart")
+	if err := ssh.Reload(config); err != nil {
+		slog.Error("could not apply reloaded config", "err", err)
+	}
+}
+
+// buildSshAegis builds the app from the given config. If dryRun is set, the sshd config is not written and ssh is
+// not restarted, the changes are printed to stdout instead.
+func buildSshAegis(config *SshAegisConfig, dryRun bool) (*SshAegis, error) {
+	statusSource, err := buildStatusSource(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not build status source: %w", err)
+	}
+
+	systemd, err := NewSystemd(config.SshServiceName)
+	if err != nil {
+		return nil, fmt.Errorf("could not build service reloader: %w", err)
+	}
+	var serviceProvider ServiceReloader = systemd
+
+	slog.Info("Checking if ssh service unit exists", "name", config.SshServiceName)
+	if err := serviceProvider.UnitExists(); err != nil {
+		return nil, fmt.Errorf("unit for ssh does not exist: %w", err)
+	}
+
+	configWrapper, configValidator, err := buildConfigWrapper(config, dryRun)
+	if err != nil {
+		return nil, fmt.Errorf("could not build sshd config wrapper: %w", err)
+	}
+
+	if dryRun {
+		configWrapper = newDryRunConfigWrapper(configWrapper, config.managedConfigFile(), os.Stdout)
+		serviceProvider = &dryRunServiceReloader{wrapped: serviceProvider, unitName: config.SshServiceName, out: os.Stdout}
+	}
+
+	ssh, err := NewSshAegis(configWrapper, statusSource, serviceProvider, configValidator, config)
+	if err != nil {
+		return nil, fmt.Errorf("could not build app: %w", err)
+	}
+
+	if config.VerifyListenAddresses && !dryRun {
+		ssh.listenVerifier, err = NewProcNetVerifier(systemd, config.SshdConfigFile, config.VerifyListenRetries, listenVerifyInterval)
+		if err != nil {
+			return nil, fmt.Errorf("could not build listen verifier: %w", err)
+		}
+	}
+
+	if config.Firewall == firewallNftables && !dryRun {
+		ssh.firewall, err = NewNftFirewall(config.NftBinary, config.SshdConfigFile, config.FirewallAllowedSources)
+		if err != nil {
+			return nil, fmt.Errorf("could not build firewall: %w", err)
+		}
+	}
+
+	if config.LockoutTimeoutSeconds > 0 && !dryRun {
+		ssh.watchdog, err = buildLockoutWatchdog(config)
+		if err != nil {
+			return nil, fmt.Errorf("could not build lockout watchdog: %w", err)
+		}
+	}
+
+	return ssh, nil
+}
+
+func buildLockoutWatchdog(config *SshAegisConfig) (*LockoutWatchdog, error) {
+	checks := []reachabilityCheck{
+		&connectionCheck{sshdConfigFile: config.SshdConfigFile, procRoot: procRoot, interval: connectionSampleInterval},
+	}
+
+	if len(config.LockoutProbeTargets) > 0 {
+		check := &probeCheck{timeout: configDefaultProbeTimeout * time.Second}
+		for _, target := range config.LockoutProbeTargets {
+			p, err := parseProbeTarget(target)
+			if err != nil {
+				return nil, err
+			}
+			check.probers = append(check.probers, p)
+		}
+		checks = append(checks, check)
+	}
+
+	if config.LockoutConfirmFile != "" {
+		checks = append(checks, &confirmFileCheck{file: config.LockoutConfirmFile})
+	}
+
+	return NewLockoutWatchdog(time.Duration(config.LockoutTimeoutSeconds)*time.Second, checks...)
+}
+
+func buildStatusSource(config *SshAegisConfig) (*CompositeStatus, error) {
+	sourceConfigs := config.sources()
+	quorum, err := parseSourcesPolicy(config.SourcesPolicy, len(sourceConfigs))
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]namedStatusSource, 0, len(sourceConfigs))
+	for _, sourceConfig := range sourceConfigs {
+		source, err := buildSource(sourceConfig)
+		if err != nil {
+			return nil, fmt.Errorf("could not build source %q: %w", sourceConfig.Name, err)
+		}
+		sources = append(sources, namedStatusSource{name: sourceConfig.Name, source: source})
+	}
+
+	return NewCompositeStatus(sources, quorum)
+}
+
+func buildSource(config SourceConfig) (TunnelStatusSource, error) {
+	switch config.Type {
+	case sourceTypeWireguard:
+		wgReader, err := newWgPeerReader(config.WireguardBackend)
+		if err != nil {
+			return nil, fmt.Errorf("could not build wireguard peer reader: %w", err)
+		}
+
+		maxHandshakeAge := time.Duration(config.WireguardMaxHandshakeAgeSeconds) * time.Second
+		return NewWgStatus(config.WireguardInterface, config.WireguardPeers, maxHandshakeAge, wgReader)
+	case sourceTypeProbe:
+		timeout := time.Duration(config.ProbeTimeoutSeconds) * time.Second
+		return NewProbeStatus(config.ProbeTargets, timeout, config.ProbeRetries, config.ProbeMinSuccesses)
+	case sourceTypeExec:
+		timeout := time.Duration(config.ExecTimeoutSeconds) * time.Second
+		return NewExecStatus(config.Name, config.ExecCommand, timeout, config.ExecMatch, config.ExecMapping)
+	case sourceTypeInterface:
+		return NewInterfaceStatus(config.Interface, config.InterfaceAddresses)
+	default:
+		return nil, fmt.Errorf("unknown source type %q", config.Type)
+	}
+}
+
+// buildConfigWrapper builds the wrapper for the managed sshd config and the validator for candidate configs. If dryRun
+// is set, candidates are staged in the system's temp dir so planning leaves the sshd config dir untouched.
+func buildConfigWrapper(config *SshAegisConfig, dryRun bool) (ConfigWrapper, ConfigValidator, error) {
+	sshConfigWrapper := &SshConfigWrapper{sshConfigFile: config.SshdConfigFile}
+	var configWrapper ConfigWrapper = sshConfigWrapper
+	stagingDir := filepath.Dir(config.SshdConfigFile)
+	baseConfig := ""
+
+	switch config.SshdConfigMode {
+	case sshdConfigModeMain:
+		if err := sshConfigWrapper.Verify(); err != nil {
+			return nil, nil, err
+		}
+	case sshdConfigModeDropIn:
+		dropInWrapper, err := NewSshDropInWrapper(config.SshdConfigFile, config.SshdDropInFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		slog.Info("Verifying sshd drop-in is included", "main", config.SshdConfigFile, "dropin", config.SshdDropInFile)
+		if err := dropInWrapper.Verify(); err != nil {
+			return nil, nil, err
+		}
+
+		configWrapper = dropInWrapper
+		stagingDir = filepath.Dir(config.SshdDropInFile)
+		baseConfig = config.SshdConfigFile
+	}
+
+	if config.SshdBinary == "" {
+		return configWrapper, nil, nil
+	}
+
+	if _, err := exec.LookPath(config.SshdBinary); err != nil {
+		isUsingDefaultValue := config.SshdBinary == configDefaultSshdBinary
+		if !isUsingDefaultValue {
+			return nil, nil, fmt.Errorf("sshd binary for validating configs not found: %w", err)
+		}
+		slog.Warn("Disabling validation of sshd configs, sshd binary not found", "path", config.SshdBinary)
+		return configWrapper, nil, nil
+	}
+
+	if dryRun {
+		stagingDir = os.TempDir()
+	}
+
+	configValidator, err := NewSshdValidator(config.SshdBinary, stagingDir, baseConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return configWrapper, configValidator, nil
+}
+
 func buildMetricsWriter(config *SshAegisConfig) (*MetricsWriter, error) {
 	if config.MetricsFile == "" {
 		return nil, nil
@@ -139,13 +512,32 @@ func buildMetricsWriter(config *SshAegisConfig) (*MetricsWriter, error) {
 	return NewMetricsWriter(config.MetricsFile)
 }
 
-func setupLogging() {
+func buildStateStore(config *SshAegisConfig) (*StateStore, error) {
+	if config.StateFile == "" {
+		return nil, nil
+	}
+
+	basePath := filepath.Dir(config.StateFile)
+	_, err := os.Stat(basePath)
+
+	if err != nil && os.IsNotExist(err) {
+		if config.StateFile == configDefaultStateFile {
+			slog.Warn("Disabling persisting state, path does not exist", "path", basePath)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("base path for persisting state does not exist: %w", err)
+	}
+
+	return NewStateStore(config.StateFile)
+}
+
+func setupLogging(out io.Writer) {
 	var level slog.Leveler = slog.LevelInfo
 	if flagDebug {
 		level = slog.LevelDebug
 	}
 
-	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+	handler := slog.NewTextHandler(out, &slog.HandlerOptions{
 		Level: level,
 	})
 
@@ -1,6 +1,11 @@
 package main
 
 import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -62,3 +67,258 @@ func Test_buildMetricsWriter(t *testing.T) {
 		})
 	}
 }
+
+func Test_reloadConfig(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          string
+		wantReloadError bool
+		wantConfig      []string
+	}{
+		{
+			name:            "valid config",
+			config:          `{"up": ["10.9.0.1"], "down": ["0.0.0.0"], "sshd_binary": "", "sshd_config_file": "` + validSshConfigFile + `"}`,
+			wantReloadError: false,
+			wantConfig:      []string{"ListenAddress 10.9.0.1"},
+		},
+		{
+			name:            "invalid config",
+			config:          `{"up": ["10.9.0.1"], "down": ["10.9.0.1"], "sshd_binary": "", "sshd_config_file": "` + validSshConfigFile + `"}`,
+			wantReloadError: true,
+			wantConfig:      []string{"ListenAddress 10.8.0.1"},
+		},
+		{
+			name: "changed sources",
+			config: `{"sources": [{"type": "wireguard", "wg": "wg0"}, {"type": "wireguard", "wg": "wg1"}], "sources_policy": "all", ` +
+				`"rules": [{"status": "up", "addresses": ["10.9.0.1"]}, {"addresses": ["0.0.0.0"]}], "sshd_binary": "", "sshd_config_file": "` + validSshConfigFile + `"}`,
+			wantReloadError: true,
+			wantConfig:      []string{"ListenAddress 10.8.0.1"},
+		},
+		{
+			name:            "malformed config",
+			config:          `{"up": `,
+			wantReloadError: true,
+			wantConfig:      []string{"ListenAddress 10.8.0.1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), "ssh-aegis.json")
+			if err := os.WriteFile(configFile, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			metrics.ConfigReloadErrors = 0
+			running := getDefault()
+			ssh := &SshAegis{
+				sourceSettings:  running.sourceSettings(),
+				sources:         running.sources(),
+				configWrapper:   &dummyConfigWrapper{config: []string{"ListenAddress 10.8.0.1"}},
+				serviceProvider: &dummyServiceReloader{},
+				rules:           newLegacyAddressRules([]string{"10.8.0.1"}, []string{"0.0.0.0"}, nil),
+				oldStatus:       Up,
+				checked:         true,
+			}
+
+			reloadConfig(ssh, configFile)
+
+			if gotReloadError := metrics.ConfigReloadErrors > 0; gotReloadError != tt.wantReloadError {
+				t.Errorf("reloadConfig() reload error = %v, want %v", gotReloadError, tt.wantReloadError)
+			}
+
+			config, _ := ssh.configWrapper.GetConfig()
+			if !reflect.DeepEqual(config, tt.wantConfig) {
+				t.Errorf("reloadConfig() config = %v, want %v", config, tt.wantConfig)
+			}
+		})
+	}
+}
+
+func Test_reloadConfigInterfaceSource(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "ssh-aegis.json")
+	writeTestFile(t, configFile, `{"up": ["10.9.0.1"], "down": ["0.0.0.0"], "sources": [{"type": "interface", "interface": "tun0"}], `+
+		`"sshd_binary": "", "sshd_config_file": "`+validSshConfigFile+`"}`)
+
+	running := getDefault()
+	running.ListenAddressesUp = []string{"10.8.0.1"}
+	running.Sources = []SourceConfig{{Type: sourceTypeInterface, Interface: "tun0"}}
+	iface, err := NewInterfaceStatus("tun0", []string{"10.8.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := NewCompositeStatus([]namedStatusSource{{name: "tun0", source: iface}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics.ConfigReloadErrors = 0
+	ssh := &SshAegis{
+		sourceSettings:     running.sourceSettings(),
+		sources:            running.sources(),
+		tunnelStatusSource: source,
+		configWrapper:      &dummyConfigWrapper{config: []string{"ListenAddress 10.8.0.1"}},
+		serviceProvider:    &dummyServiceReloader{},
+		rules:              newLegacyAddressRules([]string{"10.8.0.1"}, []string{"0.0.0.0"}, nil),
+		oldStatus:          Up,
+		checked:            true,
+	}
+
+	// the interface source requires the addresses for status up, changing them does not change the sources
+	reloadConfig(ssh, configFile)
+	if metrics.ConfigReloadErrors > 0 {
+		t.Fatalf("reloadConfig() failed for changed addresses of an interface source")
+	}
+	if want := []net.IP{net.ParseIP("10.9.0.1")}; !reflect.DeepEqual(iface.addresses, want) {
+		t.Errorf("reloadConfig() interface addresses = %v, want %v", iface.addresses, want)
+	}
+	if config, _ := ssh.configWrapper.GetConfig(); !reflect.DeepEqual(config, []string{"ListenAddress 10.9.0.1"}) {
+		t.Errorf("reloadConfig() config = %v, want [ListenAddress 10.9.0.1]", config)
+	}
+}
+
+func Test_buildConfigWrapper(t *testing.T) {
+	_, defaultErr := exec.LookPath(configDefaultSshdBinary)
+
+	tests := []struct {
+		name          string
+		sshdBinary    string
+		wantValidator bool
+		wantErr       bool
+	}{
+		{
+			name:          "validation disabled",
+			sshdBinary:    "",
+			wantValidator: false,
+		},
+		{
+			name:          "default binary",
+			sshdBinary:    configDefaultSshdBinary,
+			wantValidator: defaultErr == nil,
+		},
+		{
+			name:       "configured binary not found",
+			sshdBinary: "/nonexistent/sshd",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), "sshd_config")
+			if err := os.WriteFile(configFile, []byte("ListenAddress 0.0.0.0\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			config := getDefault()
+			config.SshdConfigFile = configFile
+			config.SshdBinary = tt.sshdBinary
+			_, validator, err := buildConfigWrapper(&config, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildConfigWrapper() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (validator != nil) != tt.wantValidator {
+				t.Errorf("buildConfigWrapper() validator = %v, wantValidator %v", validator, tt.wantValidator)
+			}
+		})
+	}
+}
+
+func Test_buildStateStore(t *testing.T) {
+	tests := []struct {
+		name      string
+		stateFile string
+		wantNil   bool
+		wantErr   bool
+	}{
+		{
+			name:      "no state wanted",
+			stateFile: "",
+			wantNil:   true,
+			wantErr:   false,
+		},
+		{
+			name:      "state wanted but invalid path",
+			stateFile: "/nonexistent/state.json",
+			wantNil:   true,
+			wantErr:   true,
+		},
+		{
+			name:      "default path does not exist",
+			stateFile: configDefaultStateFile,
+			wantNil:   true,
+			wantErr:   false,
+		},
+		{
+			name:      "valid path",
+			stateFile: filepath.Join(t.TempDir(), "state.json"),
+			wantNil:   false,
+			wantErr:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.stateFile == configDefaultStateFile {
+				if _, err := os.Stat(filepath.Dir(configDefaultStateFile)); err == nil {
+					t.Skip("default state dir exists on this system")
+				}
+			}
+
+			got, err := buildStateStore(&SshAegisConfig{StateFile: tt.stateFile})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("buildStateStore() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("buildStateStore() got = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func Test_parseCommandFlags(t *testing.T) {
+	up := Up
+	unknown := Unknown
+	tests := []struct {
+		name    string
+		args    []string
+		want    *TunnelStatus
+		wantErr bool
+	}{
+		{
+			name: "no status",
+			args: nil,
+			want: nil,
+		},
+		{
+			name: "status up",
+			args: []string{"--status", "up"},
+			want: &up,
+		},
+		{
+			name: "status unknown",
+			args: []string{"-status=unknown"},
+			want: &unknown,
+		},
+		{
+			name:    "invalid status",
+			args:    []string{"--status", "sideways"},
+			wantErr: true,
+		},
+		{
+			name:    "unexpected argument",
+			args:    []string{"--status", "up", "down"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCommandFlags(commandPlan, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseCommandFlags() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCommandFlags() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"fmt"
 	"log"
+	"maps"
 	"os"
+	"sync/atomic"
 	"text/template"
 	"time"
 )
@@ -17,6 +19,11 @@ ssh_aegis_timestamp_seconds {{ .Now }}
 # HELP ssh_aegis_status represents the status of the tunnel
 # TYPE ssh_aegis_status gauge
 ssh_aegis_status{status="{{ .Status }}"} 1
+# HELP ssh_aegis_source_status represents the status of each configured source
+# TYPE ssh_aegis_source_status gauge
+{{- range $source, $status := .SourceStatus }}
+ssh_aegis_source_status{source="{{ $source }}",status="{{ $status }}"} 1
+{{- end }}
 # HELP ssh_aegis_last_status_change_timestamp_seconds represents the status of the tunnel
 # TYPE ssh_aegis_last_status_change_timestamp_seconds gauge
 ssh_aegis_last_status_change_timestamp_seconds {{ .LastStatusChange }}
@@ -29,6 +36,48 @@ ssh_aegis_config_read_errors {{ .ConfigReadErrors }}
 # HELP ssh_aegis_config_write_errors Number of errors encountered while writing the config.
 # TYPE ssh_aegis_config_write_errors counter
 ssh_aegis_config_write_errors {{ .ConfigWriteErrors }}
+# HELP ssh_aegis_config_validation_errors Number of candidate configs rejected by 'sshd -t'.
+# TYPE ssh_aegis_config_validation_errors counter
+ssh_aegis_config_validation_errors {{ .ConfigValidationErrors }}
+# HELP ssh_aegis_config_rollbacks Number of times the previous config was restored after ssh failed to restart.
+# TYPE ssh_aegis_config_rollbacks counter
+ssh_aegis_config_rollbacks {{ .ConfigRollbacks }}
+# HELP ssh_aegis_config_rollback_errors Number of errors encountered while restoring the previous config.
+# TYPE ssh_aegis_config_rollback_errors counter
+ssh_aegis_config_rollback_errors {{ .ConfigRollbackErrors }}
+# HELP ssh_aegis_suppressed_flaps Number of status changes that were discarded before reaching their transition threshold.
+# TYPE ssh_aegis_suppressed_flaps counter
+ssh_aegis_suppressed_flaps {{ .SuppressedFlaps }}
+# HELP ssh_aegis_config_reload_errors Number of config reloads that were rejected.
+# TYPE ssh_aegis_config_reload_errors counter
+ssh_aegis_config_reload_errors {{ .ConfigReloadErrors }}
+# HELP ssh_aegis_listen_mismatches Number of times ssh was not listening on the wanted addresses after a restart.
+# TYPE ssh_aegis_listen_mismatches counter
+ssh_aegis_listen_mismatches {{ .ListenMismatches }}
+# HELP ssh_aegis_listen_fallbacks Number of times the addresses for status 'down' were applied after a listen mismatch.
+# TYPE ssh_aegis_listen_fallbacks counter
+ssh_aegis_listen_fallbacks {{ .ListenFallbacks }}
+# HELP ssh_aegis_config_drift Whether the configured listen addresses differ from the wanted addresses.
+# TYPE ssh_aegis_config_drift gauge
+ssh_aegis_config_drift {{ .ConfigDrift }}
+# HELP ssh_aegis_config_drift_repairs Number of times the listen addresses were rewritten after detecting config drift.
+# TYPE ssh_aegis_config_drift_repairs counter
+ssh_aegis_config_drift_repairs {{ .DriftRepairs }}
+# HELP ssh_aegis_lockout_active Whether the addresses for status 'down' are enforced as ssh could not be confirmed reachable.
+# TYPE ssh_aegis_lockout_active gauge
+ssh_aegis_lockout_active {{ .LockoutActive }}
+# HELP ssh_aegis_lockout_reverts Number of times no evidence of ssh being reachable was found in time after switching to the addresses for status 'up'.
+# TYPE ssh_aegis_lockout_reverts counter
+ssh_aegis_lockout_reverts {{ .LockoutReverts }}
+# HELP ssh_aegis_firewall_restricted Whether access to ssh is restricted to allow-listed sources.
+# TYPE ssh_aegis_firewall_restricted gauge
+ssh_aegis_firewall_restricted {{ .FirewallRestricted }}
+# HELP ssh_aegis_firewall_errors Number of errors encountered while updating the firewall.
+# TYPE ssh_aegis_firewall_errors counter
+ssh_aegis_firewall_errors {{ .FirewallErrors }}
+# HELP ssh_aegis_state_write_errors Number of errors encountered while persisting the state.
+# TYPE ssh_aegis_state_write_errors counter
+ssh_aegis_state_write_errors {{ .StateWriteErrors }}
 `
 
 var metrics = Metrics{
@@ -41,13 +90,41 @@ var metrics = Metrics{
 }
 
 type Metrics struct {
-	Version           map[string]string
-	Now               int64
-	Status            TunnelStatus
-	LastStatusChange  int64
-	RestartSshErrors  int
-	ConfigReadErrors  int
-	ConfigWriteErrors int
+	Version                map[string]string
+	Now                    int64
+	Status                 TunnelStatus
+	SourceStatus           map[string]TunnelStatus
+	LastStatusChange       int64
+	RestartSshErrors       int
+	ConfigReadErrors       int
+	ConfigWriteErrors      int
+	ConfigValidationErrors int
+	ConfigRollbacks        int
+	ConfigRollbackErrors   int
+	SuppressedFlaps        int
+	ConfigReloadErrors     int
+	StateWriteErrors       int
+	ListenMismatches       int
+	ListenFallbacks        int
+	ConfigDrift            int
+	DriftRepairs           int
+	LockoutActive          int
+	LockoutReverts         int
+	FirewallRestricted     int
+	FirewallErrors         int
+	// ListenAddresses are the addresses sshd is configured to listen on, they are not exported as metric
+	ListenAddresses []string
+}
+
+// metricsSnapshot holds a copy of the metrics that can be read safely from other goroutines.
+var metricsSnapshot atomic.Pointer[Metrics]
+
+// publishMetrics makes the current metrics available to other goroutines. It must be called from the goroutine
+// updating the metrics.
+func publishMetrics() {
+	snapshot := metrics
+	snapshot.SourceStatus = maps.Clone(metrics.SourceStatus)
+	metricsSnapshot.Store(&snapshot)
 }
 
 type MetricsWriter struct {
@@ -55,8 +132,12 @@ type MetricsWriter struct {
 	metricsFile string
 }
 
+func parseMetricsTemplate() (*template.Template, error) {
+	return template.New("metrics").Parse(templateData)
+}
+
 func NewMetricsWriter(metricsFile string) (*MetricsWriter, error) {
-	tmpl, err := template.New("metrics").Parse(templateData)
+	tmpl, err := parseMetricsTemplate()
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+const (
+	metricsServerRetryInterval   = 10 * time.Second
+	metricsServerShutdownTimeout = 5 * time.Second
+	metricsServerHeaderTimeout   = 5 * time.Second
+)
+
+type statusResponse struct {
+	Status           string   `json:"status"`
+	LastStatusChange int64    `json:"last_status_change"`
+	ListenAddresses  []string `json:"listen_addresses"`
+}
+
+// MetricsServer serves the metrics in Prometheus exposition format as well as health and status endpoints.
+type MetricsServer struct {
+	address string
+	tmpl    *template.Template
+	server  *http.Server
+}
+
+func NewMetricsServer(address string) (*MetricsServer, error) {
+	if address == "" {
+		return nil, errors.New("empty listen address provided")
+	}
+
+	tmpl, err := parseMetricsTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MetricsServer{
+		address: address,
+		tmpl:    tmpl,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", m.handleMetrics)
+	mux.HandleFunc("GET /healthz", m.handleHealthz)
+	mux.HandleFunc("GET /status", m.handleStatus)
+	m.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: metricsServerHeaderTimeout,
+	}
+
+	return m, nil
+}
+
+// Run serves requests until ctx is cancelled. If the address can not be bound, e.g. because it belongs to a VPN
+// interface that is not up yet, binding is retried periodically.
+func (m *MetricsServer) Run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), metricsServerShutdownTimeout)
+		defer cancel()
+		_ = m.server.Shutdown(shutdownCtx)
+	}()
+
+	for {
+		listener, err := net.Listen("tcp", m.address)
+		if err == nil {
+			slog.Info("Serving metrics", "address", m.address)
+			err = m.server.Serve(listener)
+			if errors.Is(err, http.ErrServerClosed) {
+				return
+			}
+		}
+
+		slog.Warn("Could not serve metrics, retrying", "address", m.address, "err", err, "retry_in", metricsServerRetryInterval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(metricsServerRetryInterval):
+		}
+	}
+}
+
+func (m *MetricsServer) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	snapshot := metricsSnapshot.Load()
+	if snapshot == nil {
+		http.Error(w, "no metrics available yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	data := *snapshot
+	data.Now = time.Now().Unix()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := m.tmpl.Execute(w, data); err != nil {
+		slog.Error("could not render metrics", "err", err)
+	}
+}
+
+func (m *MetricsServer) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	if metricsSnapshot.Load() == nil {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+func (m *MetricsServer) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	snapshot := metricsSnapshot.Load()
+	if snapshot == nil {
+		http.Error(w, "no status available yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(statusResponse{
+		Status:           snapshot.Status.String(),
+		LastStatusChange: snapshot.LastStatusChange,
+		ListenAddresses:  snapshot.ListenAddresses,
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMetricsServer_handlers(t *testing.T) {
+	m, err := NewMetricsServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("NewMetricsServer() error = %v", err)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		m.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	metricsSnapshot.Store(nil)
+	for _, path := range []string{"/metrics", "/healthz", "/status"} {
+		if rec := get(path); rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("GET %s before first check = %d, want %d", path, rec.Code, http.StatusServiceUnavailable)
+		}
+	}
+
+	metrics.Status = Up
+	metrics.LastStatusChange = 1700000000
+	metrics.ListenAddresses = []string{"10.8.0.1"}
+	publishMetrics()
+	defer metricsSnapshot.Store(nil)
+
+	rec := get("/metrics")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), `ssh_aegis_status{status="up"} 1`) {
+		t.Errorf("GET /metrics does not contain status: %s", rec.Body.String())
+	}
+
+	if rec := get("/healthz"); rec.Code != http.StatusOK {
+		t.Errorf("GET /healthz = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = get("/status")
+	var got statusResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("could not parse status: %v", err)
+	}
+	want := statusResponse{
+		Status:           "up",
+		LastStatusChange: 1700000000,
+		ListenAddresses:  []string{"10.8.0.1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GET /status = %v, want %v", got, want)
+	}
+
+	if rec := get("/unknown"); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /unknown = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	nlaHeaderLen  = 4
+	nlaFNested    = 0x8000
+	nlaTypeMask   = 0x3fff
+	nlReadTimeout = 5 * time.Second
+)
+
+type nlAttr struct {
+	Type uint16
+	Data []byte
+}
+
+// netlinkConn is a minimal netlink socket built on raw syscalls, suitable for request/response exchanges and for
+// receiving multicast notifications.
+type netlinkConn struct {
+	fd  int
+	seq uint32
+	pid uint32
+}
+
+func newNetlinkConn(protocol int, groups uint32) (*netlinkConn, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, protocol)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: groups}); err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+
+	addr, err := syscall.Getsockname(fd)
+	if err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("getsockname", err)
+	}
+
+	conn := &netlinkConn{fd: fd}
+	if nlAddr, ok := addr.(*syscall.SockaddrNetlink); ok {
+		conn.pid = nlAddr.Pid
+	}
+
+	return conn, nil
+}
+
+func (c *netlinkConn) Close() error {
+	return syscall.Close(c.fd)
+}
+
+func (c *netlinkConn) setReadTimeout(timeout time.Duration) error {
+	tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptTimeval(c.fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv))
+}
+
+// execute sends a request and collects all response messages until the kernel signals the end of the exchange.
+func (c *netlinkConn) execute(msgType uint16, flags uint16, payload []byte) ([]syscall.NetlinkMessage, error) {
+	if err := c.setReadTimeout(nlReadTimeout); err != nil {
+		return nil, err
+	}
+
+	c.seq++
+	req := make([]byte, syscall.NLMSG_HDRLEN, syscall.NLMSG_HDRLEN+len(payload))
+	binary.NativeEndian.PutUint32(req[0:4], uint32(syscall.NLMSG_HDRLEN+len(payload))) //nolint:gosec
+	binary.NativeEndian.PutUint16(req[4:6], msgType)
+	binary.NativeEndian.PutUint16(req[6:8], flags|syscall.NLM_F_REQUEST|syscall.NLM_F_ACK)
+	binary.NativeEndian.PutUint32(req[8:12], c.seq)
+	req = append(req, payload...)
+
+	if err := syscall.Sendto(c.fd, req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, os.NewSyscallError("sendto", err)
+	}
+
+	var ret []syscall.NetlinkMessage
+	for {
+		msgs, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msg := range msgs {
+			if msg.Header.Seq != c.seq {
+				continue
+			}
+
+			switch msg.Header.Type {
+			case syscall.NLMSG_DONE:
+				return ret, nil
+			case syscall.NLMSG_ERROR:
+				if len(msg.Data) < 4 {
+					return nil, errors.New("truncated netlink error message")
+				}
+				errno := int32(binary.NativeEndian.Uint32(msg.Data[0:4])) //nolint:gosec
+				if errno != 0 {
+					return nil, syscall.Errno(-errno)
+				}
+				// an ack without error terminates non-dump requests
+				return ret, nil
+			default:
+				ret = append(ret, msg)
+			}
+		}
+	}
+}
+
+func (c *netlinkConn) receive() ([]syscall.NetlinkMessage, error) {
+	buf := make([]byte, os.Getpagesize()*8)
+	for {
+		n, _, err := syscall.Recvfrom(c.fd, buf, 0)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return nil, os.NewSyscallError("recvfrom", err)
+		}
+		if n < syscall.NLMSG_HDRLEN {
+			return nil, fmt.Errorf("short netlink message of %d bytes", n)
+		}
+
+		return syscall.ParseNetlinkMessage(buf[:n])
+	}
+}
+
+func nlAlign(length int) int {
+	return (length + syscall.NLA_ALIGNTO - 1) & ^(syscall.NLA_ALIGNTO - 1)
+}
+
+func parseNlAttrs(data []byte) ([]nlAttr, error) {
+	var attrs []nlAttr
+	for len(data) >= nlaHeaderLen {
+		length := int(binary.NativeEndian.Uint16(data[0:2]))
+		if length < nlaHeaderLen || length > len(data) {
+			return nil, fmt.Errorf("invalid netlink attribute length %d", length)
+		}
+
+		attrs = append(attrs, nlAttr{
+			Type: binary.NativeEndian.Uint16(data[2:4]) & nlaTypeMask,
+			Data: data[nlaHeaderLen:length],
+		})
+
+		data = data[min(nlAlign(length), len(data)):]
+	}
+
+	return attrs, nil
+}
+
+func encodeNlAttr(attrType uint16, data []byte) []byte {
+	length := nlaHeaderLen + len(data)
+	buf := make([]byte, nlAlign(length))
+	binary.NativeEndian.PutUint16(buf[0:2], uint16(length)) //nolint:gosec
+	binary.NativeEndian.PutUint16(buf[2:4], attrType)
+	copy(buf[nlaHeaderLen:], data)
+	return buf
+}
+
+func encodeNlAttrString(attrType uint16, value string) []byte {
+	return encodeNlAttr(attrType, append([]byte(value), 0))
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	nftTableName      = "ssh_aegis"
+	nftResolveTimeout = 5 * time.Second
+)
+
+var (
+	hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*\.?$`)
+	// numericPattern matches malformed IP addresses such as 10.0.0.256, which the resolver may still interpret as an
+	// address instead of looking them up as a hostname.
+	numericPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*\.?$`)
+)
+
+// NftFirewall restricts access to ssh using a dedicated 'inet ssh_aegis' table. The table is always replaced as a
+// whole within a single 'nft -f' transaction, so there is no point in time when the ruleset is only partially applied.
+type NftFirewall struct {
+	nftBinary      string
+	sshdConfigFile string
+	allowed        []string
+
+	// resolved holds the last addresses hostnames resolved to, they are used if resolving fails
+	resolved map[string][]netip.Addr
+	// applied is the ruleset that has been applied last, empty if the table has been removed
+	applied string
+	// lifted is set once the table is known to be absent
+	lifted bool
+
+	lookup func(ctx context.Context, host string) ([]netip.Addr, error)
+	run    func(ruleset string) error
+}
+
+func NewNftFirewall(nftBinary string, sshdConfigFile string, allowed []string) (*NftFirewall, error) {
+	if nftBinary == "" {
+		return nil, errors.New("empty nft binary provided")
+	}
+
+	if sshdConfigFile == "" {
+		return nil, errors.New("empty sshd config file provided")
+	}
+
+	if len(allowed) == 0 {
+		return nil, errors.New("no allowed sources provided")
+	}
+
+	for _, source := range allowed {
+		if err := validateAllowedSource(source); err != nil {
+			return nil, err
+		}
+	}
+
+	f := &NftFirewall{
+		nftBinary:      nftBinary,
+		sshdConfigFile: sshdConfigFile,
+		allowed:        allowed,
+		resolved:       map[string][]netip.Addr{},
+		lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+	}
+	f.run = f.runNft
+	return f, nil
+}
+
+// validateAllowedSource accepts CIDRs, IP addresses and hostnames.
+func validateAllowedSource(source string) error {
+	if _, err := netip.ParsePrefix(source); err == nil {
+		return nil
+	}
+
+	if _, err := netip.ParseAddr(source); err == nil {
+		return nil
+	}
+
+	if !hostnamePattern.MatchString(source) || numericPattern.MatchString(source) {
+		return fmt.Errorf("invalid allowed source %q, expected a CIDR, an IP address or a hostname", source)
+	}
+
+	return nil
+}
+
+// Restrict only allows the allowed sources to reach the ports sshd listens on for the given addresses. Hostnames are
+// resolved on every call, the ruleset is only applied if it changed. If none of the allowed sources can be resolved,
+// the ruleset is left as is, as it would drop all ssh traffic.
+func (f *NftFirewall) Restrict(addresses []string) error {
+	sockets, err := expectedSockets(f.sshdConfigFile, addresses)
+	if err != nil {
+		return err
+	}
+
+	var ports []int
+	for _, socket := range sockets {
+		if !slices.Contains(ports, socket.port) {
+			ports = append(ports, socket.port)
+		}
+	}
+	slices.Sort(ports)
+
+	prefixes := f.allowedPrefixes()
+	if len(prefixes) == 0 {
+		return errors.New("none of the allowed sources could be resolved, keeping the current ruleset")
+	}
+
+	ruleset := renderNftRuleset(ports, prefixes)
+	if ruleset == f.applied {
+		return nil
+	}
+
+	slog.Info("Restricting access to ssh", "ports", ports, "allowed", f.allowed)
+	if err := f.run(ruleset); err != nil {
+		return err
+	}
+
+	f.applied = ruleset
+	f.lifted = false
+	return nil
+}
+
+// Lift removes the table managed by ssh-aegis.
+func (f *NftFirewall) Lift() error {
+	if f.lifted {
+		return nil
+	}
+
+	slog.Info("Lifting restricted access to ssh")
+	ruleset := fmt.Sprintf("table inet %s\ndelete table inet %s\n", nftTableName, nftTableName)
+	if err := f.run(ruleset); err != nil {
+		return err
+	}
+
+	f.applied = ""
+	f.lifted = true
+	return nil
+}
+
+// allowedPrefixes returns the allowed sources as prefixes. Hostnames that can not be resolved keep the addresses they
+// resolved to previously.
+func (f *NftFirewall) allowedPrefixes() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, source := range f.allowed {
+		if prefix, err := netip.ParsePrefix(source); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		if addr, err := netip.ParseAddr(source); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), nftResolveTimeout)
+		addrs, err := f.lookup(ctx, source)
+		cancel()
+		if err != nil {
+			slog.Warn("Could not resolve allowed source, using previous addresses", "source", source, "previous", f.resolved[source], "err", err)
+			addrs = f.resolved[source]
+		} else {
+			f.resolved[source] = addrs
+		}
+
+		for _, addr := range addrs {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		}
+	}
+
+	return prefixes
+}
+
+// renderNftRuleset renders a ruleset replacing the table managed by ssh-aegis. Declaring the table before deleting it
+// makes the deletion succeed even if the table does not exist yet.
+func renderNftRuleset(ports []int, allowed []netip.Prefix) string {
+	var ipv4, ipv6 []string
+	for _, prefix := range allowed {
+		if prefix.Addr().Is4() {
+			ipv4 = append(ipv4, prefix.String())
+		} else {
+			ipv6 = append(ipv6, prefix.String())
+		}
+	}
+
+	formattedPorts := make([]string, len(ports))
+	for idx, port := range ports {
+		formattedPorts[idx] = strconv.Itoa(port)
+	}
+	dports := strings.Join(formattedPorts, ", ")
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "table inet %s\n", nftTableName)
+	fmt.Fprintf(&sb, "delete table inet %s\n", nftTableName)
+	fmt.Fprintf(&sb, "table inet %s {\n", nftTableName)
+	writeNftSet(&sb, "allowed_ipv4", "ipv4_addr", ipv4)
+	writeNftSet(&sb, "allowed_ipv6", "ipv6_addr", ipv6)
+	sb.WriteString("\tchain input {\n")
+	sb.WriteString("\t\ttype filter hook input priority -10; policy accept;\n")
+	sb.WriteString("\t\tiifname \"lo\" accept\n")
+	sb.WriteString("\t\tct state established,related accept\n")
+	fmt.Fprintf(&sb, "\t\ttcp dport { %s } ip saddr @allowed_ipv4 accept\n", dports)
+	fmt.Fprintf(&sb, "\t\ttcp dport { %s } ip6 saddr @allowed_ipv6 accept\n", dports)
+	fmt.Fprintf(&sb, "\t\ttcp dport { %s } drop\n", dports)
+	sb.WriteString("\t}\n")
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
+
+func writeNftSet(sb *strings.Builder, name string, addrType string, elements []string) {
+	fmt.Fprintf(sb, "\tset %s {\n", name)
+	fmt.Fprintf(sb, "\t\ttype %s\n", addrType)
+	sb.WriteString("\t\tflags interval\n")
+	sb.WriteString("\t\tauto-merge\n")
+	if len(elements) > 0 {
+		fmt.Fprintf(sb, "\t\telements = { %s }\n", strings.Join(elements, ", "))
+	}
+	sb.WriteString("\t}\n")
+}
+
+func (f *NftFirewall) runNft(ruleset string) error {
+	//nolint G204
+	cmd := exec.Command(f.nftBinary, "-f", "-")
+	cmd.Stdin = strings.NewReader(ruleset)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("nft rejected ruleset: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"path/filepath"
+	"testing"
+)
+
+func Test_renderNftRuleset(t *testing.T) {
+	allowed := []netip.Prefix{
+		netip.MustParsePrefix("192.0.2.0/24"),
+		netip.MustParsePrefix("2001:db8::/32"),
+		netip.MustParsePrefix("198.51.100.7/32"),
+	}
+
+	want := `table inet ssh_aegis
+delete table inet ssh_aegis
+table inet ssh_aegis {
+	set allowed_ipv4 {
+		type ipv4_addr
+		flags interval
+		auto-merge
+		elements = { 192.0.2.0/24, 198.51.100.7/32 }
+	}
+	set allowed_ipv6 {
+		type ipv6_addr
+		flags interval
+		auto-merge
+		elements = { 2001:db8::/32 }
+	}
+	chain input {
+		type filter hook input priority -10; policy accept;
+		iifname "lo" accept
+		ct state established,related accept
+		tcp dport { 22, 2222 } ip saddr @allowed_ipv4 accept
+		tcp dport { 22, 2222 } ip6 saddr @allowed_ipv6 accept
+		tcp dport { 22, 2222 } drop
+	}
+}
+`
+	if got := renderNftRuleset([]int{22, 2222}, allowed); got != want {
+		t.Errorf("renderNftRuleset() got = %v, want %v", got, want)
+	}
+}
+
+func Test_validateAllowedSource(t *testing.T) {
+	tests := []struct {
+		source  string
+		wantErr bool
+	}{
+		{source: "192.0.2.0/24"},
+		{source: "2001:db8::/32"},
+		{source: "198.51.100.7"},
+		{source: "::1"},
+		{source: "bastion.example.com"},
+		{source: "bastion.example.com."},
+		{source: "192.0.2.0/33", wantErr: true},
+		{source: "-bastion.example.com", wantErr: true},
+		{source: "bastion example", wantErr: true},
+		{source: "10.0.0.256", wantErr: true},
+		{source: "192.168.1", wantErr: true},
+		{source: "3com.example.com"},
+		{source: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			if err := validateAllowedSource(tt.source); (err != nil) != tt.wantErr {
+				t.Errorf("validateAllowedSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNftFirewall_RestrictUnresolved(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "sshd_config")
+	writeTestFile(t, configFile, "Port 22\n")
+
+	f, err := NewNftFirewall("nft", configFile, []string{"bastion.example.com"})
+	if err != nil {
+		t.Fatalf("NewNftFirewall() error = %v", err)
+	}
+
+	var rulesets []string
+	f.run = func(ruleset string) error {
+		rulesets = append(rulesets, ruleset)
+		return nil
+	}
+	f.lookup = func(_ context.Context, _ string) ([]netip.Addr, error) {
+		return nil, errors.New("no such host")
+	}
+
+	// an empty allow-list would drop all ssh traffic
+	if err := f.Restrict([]string{"0.0.0.0"}); err == nil {
+		t.Errorf("Restrict() expected error if nothing resolves")
+	}
+	if len(rulesets) != 0 {
+		t.Errorf("Restrict() applied %v, want nothing", rulesets)
+	}
+}
+
+func TestNftFirewall(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "sshd_config")
+	writeTestFile(t, configFile, "Port 2222\n")
+
+	f, err := NewNftFirewall("nft", configFile, []string{"192.0.2.0/24", "bastion.example.com"})
+	if err != nil {
+		t.Fatalf("NewNftFirewall() error = %v", err)
+	}
+
+	var rulesets []string
+	f.run = func(ruleset string) error {
+		rulesets = append(rulesets, ruleset)
+		return nil
+	}
+	resolved := []netip.Addr{netip.MustParseAddr("198.51.100.7")}
+	var lookupErr error
+	f.lookup = func(_ context.Context, _ string) ([]netip.Addr, error) {
+		return resolved, lookupErr
+	}
+
+	if err := f.Restrict([]string{"0.0.0.0", "[::]:22"}); err != nil {
+		t.Fatalf("Restrict() error = %v", err)
+	}
+	want := renderNftRuleset([]int{22, 2222}, []netip.Prefix{
+		netip.MustParsePrefix("192.0.2.0/24"),
+		netip.MustParsePrefix("198.51.100.7/32"),
+	})
+	if len(rulesets) != 1 || rulesets[0] != want {
+		t.Fatalf("Restrict() applied %v, want %v", rulesets, want)
+	}
+
+	// unchanged rulesets are not applied again, failing lookups keep the previous addresses
+	lookupErr = errors.New("no such host")
+	resolved = nil
+	if err := f.Restrict([]string{"0.0.0.0", "[::]:22"}); err != nil {
+		t.Fatalf("Restrict() error = %v", err)
+	}
+	if len(rulesets) != 1 {
+		t.Errorf("Restrict() applied unchanged ruleset again")
+	}
+
+	lookupErr = nil
+	resolved = []netip.Addr{netip.MustParseAddr("198.51.100.8")}
+	if err := f.Restrict([]string{"0.0.0.0", "[::]:22"}); err != nil {
+		t.Fatalf("Restrict() error = %v", err)
+	}
+	if len(rulesets) != 2 {
+		t.Errorf("Restrict() did not apply ruleset for changed addresses")
+	}
+
+	if err := f.Lift(); err != nil {
+		t.Fatalf("Lift() error = %v", err)
+	}
+	if err := f.Lift(); err != nil {
+		t.Fatalf("Lift() error = %v", err)
+	}
+	if len(rulesets) != 3 || rulesets[2] != "table inet ssh_aegis\ndelete table inet ssh_aegis\n" {
+		t.Errorf("Lift() applied %v", rulesets[2:])
+	}
+
+	f.run = func(_ string) error {
+		return errors.New("nft failed")
+	}
+	if err := f.Restrict([]string{"0.0.0.0"}); err == nil {
+		t.Errorf("Restrict() expected error")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	probeSchemeTcp  = "tcp"
+	probeSchemeIcmp = "icmp"
+)
+
+// errProbeUnavailable signals that a target could not be probed at all, e.g. due to missing privileges, as opposed
+// to the target not being reachable.
+var errProbeUnavailable = errors.New("probe unavailable")
+
+type prober interface {
+	// probe makes a single attempt to reach the target within the given timeout.
+	probe(timeout time.Duration) error
+	String() string
+}
+
+type tcpProber struct {
+	address string
+}
+
+func (p *tcpProber) probe(timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", p.address, timeout)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+func (p *tcpProber) String() string {
+	return fmt.Sprintf("%s://%s", probeSchemeTcp, p.address)
+}
+
+// icmpProber sends an ICMP echo request using an unprivileged ping socket if permitted by net.ipv4.ping_group_range,
+// otherwise using a raw socket.
+type icmpProber struct {
+	ip net.IP
+}
+
+func (p *icmpProber) String() string {
+	if p.ip.To4() == nil {
+		return fmt.Sprintf("%s://[%s]", probeSchemeIcmp, p.ip)
+	}
+	return fmt.Sprintf("%s://%s", probeSchemeIcmp, p.ip)
+}
+
+// parseProbeTarget parses targets in the form tcp://host:port and icmp://ip.
+func parseProbeTarget(target string) (prober, error) {
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid probe target %q: %w", target, err)
+	}
+
+	if parsed.Path != "" || parsed.RawQuery != "" || parsed.User != nil {
+		return nil, fmt.Errorf("invalid probe target %q, expected tcp://host:port or icmp://ip", target)
+	}
+
+	switch parsed.Scheme {
+	case probeSchemeTcp:
+		port, err := strconv.Atoi(parsed.Port())
+		if parsed.Hostname() == "" || err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid tcp probe target %q, expected tcp://host:port", target)
+		}
+		return &tcpProber{address: parsed.Host}, nil
+	case probeSchemeIcmp:
+		ip := net.ParseIP(parsed.Hostname())
+		if ip == nil || parsed.Port() != "" {
+			return nil, fmt.Errorf("invalid icmp probe target %q, expected icmp://ip", target)
+		}
+		return &icmpProber{ip: ip}, nil
+	default:
+		return nil, fmt.Errorf("invalid probe target %q, scheme must be one of %v", target, []string{probeSchemeTcp, probeSchemeIcmp})
+	}
+}
+
+// ProbeStatus reports up if at least a minimum number of targets is reachable. Each target is retried a number of
+// times before it's considered unreachable. If targets can not be probed at all, the status may be unknown.
+type ProbeStatus struct {
+	targets      []prober
+	timeout      time.Duration
+	retries      int
+	minSuccesses int
+}
+
+func NewProbeStatus(targets []string, timeout time.Duration, retries int, minSuccesses int) (*ProbeStatus, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("no probe targets provided")
+	}
+
+	if timeout <= 0 {
+		return nil, errors.New("probe timeout must be positive")
+	}
+
+	if retries < 0 {
+		return nil, errors.New("probe retries must not be negative")
+	}
+
+	if minSuccesses < 1 || minSuccesses > len(targets) {
+		return nil, fmt.Errorf("probe min successes must be between 1 and %d", len(targets))
+	}
+
+	probers := make([]prober, 0, len(targets))
+	for _, target := range targets {
+		parsed, err := parseProbeTarget(target)
+		if err != nil {
+			return nil, err
+		}
+		probers = append(probers, parsed)
+	}
+
+	return &ProbeStatus{
+		targets:      probers,
+		timeout:      timeout,
+		retries:      retries,
+		minSuccesses: minSuccesses,
+	}, nil
+}
+
+func (p *ProbeStatus) GetStatus() TunnelStatus {
+	results := make([]error, len(p.targets))
+	var wg sync.WaitGroup
+	for idx, target := range p.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[idx] = p.probeTarget(target)
+		}()
+	}
+	wg.Wait()
+
+	successes, unavailable := 0, 0
+	for idx, err := range results {
+		switch {
+		case err == nil:
+			successes++
+			slog.Debug("Probe succeeded", "target", p.targets[idx])
+		case errors.Is(err, errProbeUnavailable):
+			unavailable++
+			slog.Warn("Could not probe target", "target", p.targets[idx], "err", err)
+		default:
+			slog.Debug("Probe failed", "target", p.targets[idx], "err", err)
+		}
+	}
+
+	if successes >= p.minSuccesses {
+		return Up
+	}
+	if successes+unavailable < p.minSuccesses {
+		return Down
+	}
+	return Unknown
+}
+
+func (p *ProbeStatus) probeTarget(target prober) error {
+	var err error
+	for attempt := 1; attempt <= p.retries+1; attempt++ {
+		err = target.probe(p.timeout)
+		if err == nil || errors.Is(err, errProbeUnavailable) {
+			return err
+		}
+		slog.Debug("Probe attempt failed", "target", target, "attempt", attempt, "err", err)
+	}
+
+	return err
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	icmpHeaderLength  = 8
+	icmpPayloadLength = 16
+	icmpMaxReplySize  = 1500
+
+	icmpv4EchoRequest = 8
+	icmpv4EchoReply   = 0
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+var icmpSequence atomic.Uint32
+
+// icmpSocket is either an unprivileged ping socket, for which the kernel manages the echo identifier, or a raw
+// socket, which receives all icmp messages and, for IPv4, prepends the IP header.
+type icmpSocket struct {
+	fd  int
+	raw bool
+	v6  bool
+}
+
+func openIcmpSocket(v6 bool) (*icmpSocket, error) {
+	family, protocol := syscall.AF_INET, syscall.IPPROTO_ICMP
+	if v6 {
+		family, protocol = syscall.AF_INET6, syscall.IPPROTO_ICMPV6
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, protocol)
+	if err == nil {
+		return &icmpSocket{fd: fd, v6: v6}, nil
+	}
+	if !errors.Is(err, syscall.EACCES) && !errors.Is(err, syscall.EPERM) {
+		return nil, fmt.Errorf("%w: %w", errProbeUnavailable, os.NewSyscallError("socket", err))
+	}
+
+	// ping sockets are restricted to the groups in net.ipv4.ping_group_range
+	fd, rawErr := syscall.Socket(family, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, protocol)
+	if rawErr != nil {
+		return nil, fmt.Errorf("%w: neither ping nor raw sockets are permitted: %w", errProbeUnavailable, os.NewSyscallError("socket", rawErr))
+	}
+
+	return &icmpSocket{fd: fd, raw: true, v6: v6}, nil
+}
+
+func (p *icmpProber) probe(timeout time.Duration) error {
+	v6 := p.ip.To4() == nil
+	sock, err := openIcmpSocket(v6)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(sock.fd)
+
+	var addr syscall.Sockaddr
+	if v6 {
+		sa := &syscall.SockaddrInet6{}
+		copy(sa.Addr[:], p.ip.To16())
+		addr = sa
+	} else {
+		sa := &syscall.SockaddrInet4{}
+		copy(sa.Addr[:], p.ip.To4())
+		addr = sa
+	}
+
+	request, err := sock.echoRequest()
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	if err := syscall.Sendto(sock.fd, request, 0, addr); err != nil {
+		return os.NewSyscallError("sendto", err)
+	}
+
+	buf := make([]byte, icmpMaxReplySize)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return errors.New("timed out waiting for icmp echo reply")
+		}
+
+		tv := syscall.NsecToTimeval(remaining.Nanoseconds())
+		if err := syscall.SetsockoptTimeval(sock.fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+
+		n, from, err := syscall.Recvfrom(sock.fd, buf, 0)
+		switch {
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case errors.Is(err, syscall.EAGAIN), errors.Is(err, syscall.EWOULDBLOCK):
+			return errors.New("timed out waiting for icmp echo reply")
+		case err != nil:
+			return os.NewSyscallError("recvfrom", err)
+		}
+
+		if sameSockaddrIP(from, addr) && sock.isEchoReply(buf[:n], request) {
+			return nil
+		}
+	}
+}
+
+func (s *icmpSocket) echoRequest() ([]byte, error) {
+	request := make([]byte, icmpHeaderLength+icmpPayloadLength)
+	request[0] = icmpv4EchoRequest
+	if s.v6 {
+		request[0] = icmpv6EchoRequest
+	}
+
+	// the identifier is replaced by the kernel for ping sockets
+	if _, err := rand.Read(request[4:6]); err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(request[6:8], uint16(icmpSequence.Add(1))) //nolint:gosec
+	if _, err := rand.Read(request[icmpHeaderLength:]); err != nil {
+		return nil, err
+	}
+
+	// the checksum is calculated by the kernel for ICMPv6 and ping sockets
+	if !s.v6 {
+		binary.BigEndian.PutUint16(request[2:4], icmpChecksum(request))
+	}
+
+	return request, nil
+}
+
+func (s *icmpSocket) isEchoReply(reply []byte, request []byte) bool {
+	if s.raw && !s.v6 {
+		if len(reply) == 0 {
+			return false
+		}
+		headerLength := int(reply[0]&0x0f) * 4
+		if len(reply) < headerLength {
+			return false
+		}
+		reply = reply[headerLength:]
+	}
+
+	wantType := byte(icmpv4EchoReply)
+	if s.v6 {
+		wantType = icmpv6EchoReply
+	}
+
+	if len(reply) != len(request) || reply[0] != wantType {
+		return false
+	}
+
+	// ping sockets only receive replies matching their identifier
+	if s.raw && !bytes.Equal(reply[4:6], request[4:6]) {
+		return false
+	}
+
+	return bytes.Equal(reply[6:], request[6:])
+}
+
+func sameSockaddrIP(a, b syscall.Sockaddr) bool {
+	switch a := a.(type) {
+	case *syscall.SockaddrInet4:
+		b, ok := b.(*syscall.SockaddrInet4)
+		return ok && a.Addr == b.Addr
+	case *syscall.SockaddrInet6:
+		b, ok := b.(*syscall.SockaddrInet6)
+		return ok && a.Addr == b.Addr
+	default:
+		return false
+	}
+}
+
+// icmpChecksum calculates the internet checksum as defined in RFC 1071.
+func icmpChecksum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+
+	return ^uint16(sum)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_icmpChecksum(t *testing.T) {
+	// echo request with id 0x1234, seq 1 and no payload
+	data := []byte{8, 0, 0, 0, 0x12, 0x34, 0, 1}
+	if got := icmpChecksum(data); got != 0xe5ca {
+		t.Errorf("icmpChecksum() = %#x, want %#x", got, 0xe5ca)
+	}
+
+	// a message including its checksum sums up to zero
+	data[2], data[3] = 0xe5, 0xca
+	if got := icmpChecksum(data); got != 0 {
+		t.Errorf("icmpChecksum() of checksummed message = %#x, want 0", got)
+	}
+}
+
+func Test_icmpProber_probe(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "::1"} {
+		t.Run(ip, func(t *testing.T) {
+			p := &icmpProber{ip: net.ParseIP(ip)}
+			err := p.probe(time.Second)
+			if errors.Is(err, errProbeUnavailable) {
+				t.Skipf("icmp probes not permitted: %v", err)
+			}
+			if err != nil {
+				t.Errorf("probe() error = %v", err)
+			}
+		})
+	}
+}
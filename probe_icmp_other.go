@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func (p *icmpProber) probe(_ time.Duration) error {
+	return fmt.Errorf("%w: icmp probes are only supported on linux", errProbeUnavailable)
+}
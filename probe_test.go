@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type dummyProber struct {
+	errs     []error
+	attempts int
+}
+
+func (d *dummyProber) probe(_ time.Duration) error {
+	d.attempts++
+	if len(d.errs) == 0 {
+		return nil
+	}
+	err := d.errs[0]
+	d.errs = d.errs[1:]
+	return err
+}
+
+func (d *dummyProber) String() string {
+	return "dummy"
+}
+
+func Test_parseProbeTarget(t *testing.T) {
+	tests := []struct {
+		target  string
+		want    prober
+		wantErr bool
+	}{
+		{target: "tcp://10.8.0.254:22", want: &tcpProber{address: "10.8.0.254:22"}},
+		{target: "tcp://[fd00::1]:22", want: &tcpProber{address: "[fd00::1]:22"}},
+		{target: "tcp://gateway.vpn:443", want: &tcpProber{address: "gateway.vpn:443"}},
+		{target: "icmp://10.8.0.254", want: &icmpProber{ip: net.ParseIP("10.8.0.254")}},
+		{target: "icmp://[fd00::1]", want: &icmpProber{ip: net.ParseIP("fd00::1")}},
+		{target: "tcp://10.8.0.254", wantErr: true},
+		{target: "tcp://10.8.0.254:0", wantErr: true},
+		{target: "tcp://:22", wantErr: true},
+		{target: "icmp://gateway.vpn", wantErr: true},
+		{target: "icmp://10.8.0.254:22", wantErr: true},
+		{target: "udp://10.8.0.254:53", wantErr: true},
+		{target: "tcp://10.8.0.254:22/path", wantErr: true},
+		{target: "10.8.0.254", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			got, err := parseProbeTarget(tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseProbeTarget() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseProbeTarget() got = %v, want %v", got, tt.want)
+			}
+			if got != nil && got.String() != tt.target {
+				t.Errorf("String() = %v, want %v", got.String(), tt.target)
+			}
+		})
+	}
+}
+
+func TestProbeStatus_GetStatus(t *testing.T) {
+	errFailed := errors.New("failed")
+	errUnavailable := fmt.Errorf("%w: not permitted", errProbeUnavailable)
+
+	tests := []struct {
+		name         string
+		targets      []*dummyProber
+		retries      int
+		minSuccesses int
+		want         TunnelStatus
+		wantAttempts []int
+	}{
+		{
+			name:         "all reachable",
+			targets:      []*dummyProber{{}, {}},
+			minSuccesses: 2,
+			want:         Up,
+			wantAttempts: []int{1, 1},
+		},
+		{
+			name:         "reachable after retry",
+			targets:      []*dummyProber{{errs: []error{errFailed}}},
+			retries:      1,
+			minSuccesses: 1,
+			want:         Up,
+			wantAttempts: []int{2},
+		},
+		{
+			name:         "retries exhausted",
+			targets:      []*dummyProber{{errs: []error{errFailed, errFailed, errFailed}}},
+			retries:      2,
+			minSuccesses: 1,
+			want:         Down,
+			wantAttempts: []int{3},
+		},
+		{
+			name:         "threshold reached",
+			targets:      []*dummyProber{{errs: []error{errFailed}}, {}, {}},
+			minSuccesses: 2,
+			want:         Up,
+			wantAttempts: []int{1, 1, 1},
+		},
+		{
+			name:         "threshold missed",
+			targets:      []*dummyProber{{errs: []error{errFailed}}, {errs: []error{errFailed}}, {}},
+			minSuccesses: 2,
+			want:         Down,
+			wantAttempts: []int{1, 1, 1},
+		},
+		{
+			name:         "unavailable not retried",
+			targets:      []*dummyProber{{errs: []error{errUnavailable}}, {}},
+			retries:      3,
+			minSuccesses: 2,
+			want:         Unknown,
+			wantAttempts: []int{1, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ProbeStatus{
+				timeout:      time.Second,
+				retries:      tt.retries,
+				minSuccesses: tt.minSuccesses,
+			}
+			for _, target := range tt.targets {
+				p.targets = append(p.targets, target)
+			}
+
+			if got := p.GetStatus(); got != tt.want {
+				t.Errorf("GetStatus() = %v, want %v", got, tt.want)
+			}
+			for idx, target := range tt.targets {
+				if target.attempts != tt.wantAttempts[idx] {
+					t.Errorf("GetStatus() attempts of target %d = %d, want %d", idx, target.attempts, tt.wantAttempts[idx])
+				}
+			}
+		})
+	}
+}
+
+func Test_tcpProber_probe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+
+	p := &tcpProber{address: address}
+	if err := p.probe(time.Second); err != nil {
+		t.Errorf("probe() error = %v", err)
+	}
+
+	_ = listener.Close()
+	if err := p.probe(time.Second); err == nil {
+		t.Errorf("probe() of closed port succeeded")
+	}
+}
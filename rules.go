@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// maxRuleSources limits the number of sources as checking rules for exhaustiveness grows exponentially.
+const maxRuleSources = 8
+
+// AddressRule maps the combined status and/or the status of individual sources to listen addresses. Conditions that
+// are not set match any status. A rule without addresses keeps the current addresses.
+type AddressRule struct {
+	Status    string            `json:"status,omitempty"`
+	Sources   map[string]string `json:"sources,omitempty"`
+	Addresses []string          `json:"addresses"`
+}
+
+type addressRule struct {
+	status    *TunnelStatus
+	sources   map[string]TunnelStatus
+	addresses []string
+}
+
+func (r addressRule) matches(status TunnelStatus, sources map[string]TunnelStatus) bool {
+	if r.status != nil && *r.status != status {
+		return false
+	}
+
+	// sources without a reading are treated as unknown
+	for name, wanted := range r.sources {
+		if sources[name] != wanted {
+			return false
+		}
+	}
+
+	return true
+}
+
+// addressRules are evaluated in order, the first matching rule determines the addresses.
+type addressRules []addressRule
+
+// newLegacyAddressRules converts addresses configured per combined status to rules.
+func newLegacyAddressRules(up, down, unknown []string) addressRules {
+	statusUp, statusDown, statusUnknown := Up, Down, Unknown
+	return addressRules{
+		{status: &statusUp, addresses: up},
+		{status: &statusDown, addresses: down},
+		{status: &statusUnknown, addresses: unknown},
+	}
+}
+
+// fallbackAddresses returns the addresses used if ssh can not be reached on the wanted addresses. These are the
+// addresses of the first rule matching status down regardless of the status of the individual sources.
+func (r addressRules) fallbackAddresses() []string {
+	_, addresses := r.evaluate(Down, nil)
+	return addresses
+}
+
+// referencesSources returns whether any rule has conditions on individual sources.
+func (r addressRules) referencesSources() bool {
+	return slices.ContainsFunc(r, func(rule addressRule) bool {
+		return len(rule.sources) > 0
+	})
+}
+
+// evaluate returns the index and the addresses of the first rule matching the given statuses or -1 if no rule
+// matches.
+func (r addressRules) evaluate(status TunnelStatus, sources map[string]TunnelStatus) (int, []string) {
+	for idx, rule := range r {
+		if rule.matches(status, sources) {
+			return idx, rule.addresses
+		}
+	}
+
+	return -1, nil
+}
+
+// verifyExhaustive returns an error if any combination of the combined status and the status of the given sources
+// is not matched by a rule.
+func (r addressRules) verifyExhaustive(sourceNames []string) error {
+	if len(sourceNames) > maxRuleSources {
+		return fmt.Errorf("rules support at most %d sources", maxRuleSources)
+	}
+
+	statuses := []TunnelStatus{Up, Down, Unknown}
+	combinations := 1
+	for range len(sourceNames) + 1 {
+		combinations *= len(statuses)
+	}
+
+	sources := make(map[string]TunnelStatus, len(sourceNames))
+	for combination := range combinations {
+		status := statuses[combination%len(statuses)]
+		remainder := combination / len(statuses)
+		for _, name := range sourceNames {
+			sources[name] = statuses[remainder%len(statuses)]
+			remainder /= len(statuses)
+		}
+
+		if idx, _ := r.evaluate(status, sources); idx < 0 {
+			return fmt.Errorf("rules are not exhaustive, no rule matches status %s with %s", status, formatSourceStatuses(sourceNames, sources))
+		}
+	}
+
+	return nil
+}
+
+func compileAddressRules(rules []AddressRule, sourceNames []string) (addressRules, error) {
+	if len(rules) == 0 {
+		return nil, errors.New("no rules provided")
+	}
+
+	compiled := make(addressRules, 0, len(rules))
+	for idx, rule := range rules {
+		compiledRule, err := compileAddressRule(rule, sourceNames)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule #%d: %w", idx+1, err)
+		}
+		compiled = append(compiled, compiledRule)
+	}
+
+	return compiled, nil
+}
+
+func compileAddressRule(rule AddressRule, sourceNames []string) (addressRule, error) {
+	compiled := addressRule{
+		sources:   map[string]TunnelStatus{},
+		addresses: rule.Addresses,
+	}
+
+	if rule.Status != "" {
+		status, found := parseTunnelStatus(rule.Status)
+		if !found {
+			return addressRule{}, fmt.Errorf("invalid status %q", rule.Status)
+		}
+		compiled.status = &status
+	}
+
+	for name, value := range rule.Sources {
+		if !slices.Contains(sourceNames, name) {
+			return addressRule{}, fmt.Errorf("unknown source %q", name)
+		}
+		status, found := parseTunnelStatus(value)
+		if !found {
+			return addressRule{}, fmt.Errorf("invalid status %q for source %q", value, name)
+		}
+		compiled.sources[name] = status
+	}
+
+	for _, addr := range rule.Addresses {
+		if _, err := ParseListenAddress(addr); err != nil {
+			return addressRule{}, fmt.Errorf("invalid address supplied: %s: %w", addr, err)
+		}
+	}
+
+	return compiled, nil
+}
+
+func formatSourceStatuses(sourceNames []string, sources map[string]TunnelStatus) string {
+	if len(sourceNames) == 0 {
+		return "no sources"
+	}
+
+	formatted := make([]string, len(sourceNames))
+	for idx, name := range sourceNames {
+		formatted[idx] = fmt.Sprintf("%s=%s", name, sources[name])
+	}
+
+	return strings.Join(formatted, ", ")
+}
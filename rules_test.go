@@ -0,0 +1,158 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testSiteRules = []AddressRule{
+	{Sources: map[string]string{"wg0": "up", "wg1": "up"}, Addresses: []string{"10.8.0.1", "10.9.0.1"}},
+	{Sources: map[string]string{"wg0": "up"}, Addresses: []string{"10.8.0.1"}},
+	{Sources: map[string]string{"wg1": "up"}, Addresses: []string{"10.9.0.1"}},
+	{Addresses: []string{"0.0.0.0"}},
+}
+
+func Test_addressRules_evaluate(t *testing.T) {
+	rules, err := compileAddressRules(testSiteRules, []string{"wg0", "wg1"})
+	if err != nil {
+		t.Fatalf("compileAddressRules() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		status  TunnelStatus
+		sources map[string]TunnelStatus
+		wantIdx int
+		want    []string
+	}{
+		{
+			name:    "both up",
+			status:  Up,
+			sources: map[string]TunnelStatus{"wg0": Up, "wg1": Up},
+			wantIdx: 0,
+			want:    []string{"10.8.0.1", "10.9.0.1"},
+		},
+		{
+			name:    "first up",
+			status:  Up,
+			sources: map[string]TunnelStatus{"wg0": Up, "wg1": Down},
+			wantIdx: 1,
+			want:    []string{"10.8.0.1"},
+		},
+		{
+			name:    "second up",
+			status:  Up,
+			sources: map[string]TunnelStatus{"wg0": Unknown, "wg1": Up},
+			wantIdx: 2,
+			want:    []string{"10.9.0.1"},
+		},
+		{
+			name:    "none up",
+			status:  Down,
+			sources: map[string]TunnelStatus{"wg0": Down, "wg1": Down},
+			wantIdx: 3,
+			want:    []string{"0.0.0.0"},
+		},
+		{
+			name:    "no readings",
+			status:  Unknown,
+			sources: nil,
+			wantIdx: 3,
+			want:    []string{"0.0.0.0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotIdx, got := rules.evaluate(tt.status, tt.sources)
+			if gotIdx != tt.wantIdx {
+				t.Errorf("evaluate() idx = %v, want %v", gotIdx, tt.wantIdx)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evaluate() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newLegacyAddressRules(t *testing.T) {
+	rules := newLegacyAddressRules([]string{"10.8.0.1"}, []string{"0.0.0.0"}, nil)
+	if err := rules.verifyExhaustive(nil); err != nil {
+		t.Errorf("verifyExhaustive() error = %v", err)
+	}
+
+	for status, want := range map[TunnelStatus][]string{Up: {"10.8.0.1"}, Down: {"0.0.0.0"}, Unknown: nil} {
+		if _, got := rules.evaluate(status, nil); !reflect.DeepEqual(got, want) {
+			t.Errorf("evaluate(%v) got = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func Test_compileAddressRules(t *testing.T) {
+	tests := []struct {
+		name           string
+		rules          []AddressRule
+		wantErr        bool
+		wantExhaustive bool
+	}{
+		{
+			name:           "exhaustive with catch-all",
+			rules:          testSiteRules,
+			wantExhaustive: true,
+		},
+		{
+			name:           "not exhaustive",
+			rules:          testSiteRules[:3],
+			wantExhaustive: false,
+		},
+		{
+			name: "exhaustive by status",
+			rules: []AddressRule{
+				{Status: "up", Sources: map[string]string{"wg0": "up"}, Addresses: []string{"10.8.0.1"}},
+				{Status: "up", Addresses: []string{"10.9.0.1"}},
+				{Status: "down", Addresses: []string{"0.0.0.0"}},
+				{Status: "unknown"},
+			},
+			wantExhaustive: true,
+		},
+		{
+			name:    "unknown source",
+			rules:   []AddressRule{{Sources: map[string]string{"wg2": "up"}, Addresses: []string{"10.8.0.1"}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid source status",
+			rules:   []AddressRule{{Sources: map[string]string{"wg0": "sideways"}, Addresses: []string{"10.8.0.1"}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid status",
+			rules:   []AddressRule{{Status: "sideways", Addresses: []string{"10.8.0.1"}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid address",
+			rules:   []AddressRule{{Addresses: []string{"10.8.0.256"}}},
+			wantErr: true,
+		},
+		{
+			name:    "no rules",
+			rules:   nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sourceNames := []string{"wg0", "wg1"}
+			rules, err := compileAddressRules(tt.rules, sourceNames)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("compileAddressRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if err := rules.verifyExhaustive(sourceNames); (err == nil) != tt.wantExhaustive {
+				t.Errorf("verifyExhaustive() error = %v, wantExhaustive %v", err, tt.wantExhaustive)
+			}
+		})
+	}
+}
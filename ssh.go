@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"reflect"
 	"slices"
 	"sort"
 	"strings"
@@ -28,16 +29,83 @@ type ServiceReloader interface {
 	UnitExists() error
 }
 
+// Firewall restricts which sources can reach ssh while it listens on the addresses for status down.
+type Firewall interface {
+	// Restrict only allows allow-listed sources to reach ssh listening on the given addresses.
+	Restrict(addresses []string) error
+	// Lift removes any restriction.
+	Lift() error
+}
+
+// EffectiveConfigReader is implemented by config wrappers that can read the effective sshd config, following Include
+// directives.
+type EffectiveConfigReader interface {
+	GetEffectiveConfig() ([]sshdConfigLine, error)
+}
+
+// ConfigRenderer is implemented by config wrappers that add content of their own when writing the config.
+type ConfigRenderer interface {
+	// RenderConfig returns the lines WriteConfig would actually write for the given data.
+	RenderConfig(data []string) []string
+}
+
+type ConfigValidator interface {
+	ValidateConfig(data []string) error
+}
+
+// ListenVerifier verifies that ssh listens on the given addresses after it has been restarted.
+type ListenVerifier interface {
+	VerifyListening(addresses []string) error
+}
+
+// InterfaceAddressSetter is implemented by status sources containing interface sources.
+type InterfaceAddressSetter interface {
+	// SetInterfaceAddresses replaces the addresses required by the interface source with the given name.
+	SetInterfaceAddresses(name string, addresses []string) error
+}
+
+// SourceStatusReporter is implemented by status sources combining multiple sources.
+type SourceStatusReporter interface {
+	// SourceStatuses returns the status of the individual sources of the last reading.
+	SourceStatuses() map[string]TunnelStatus
+}
+
 type SshAegis struct {
 	configWrapper      ConfigWrapper
 	tunnelStatusSource TunnelStatusSource
 	serviceProvider    ServiceReloader
+	configValidator    ConfigValidator
+	listenVerifier     ListenVerifier
+
+	rules      addressRules
+	oldStatus  TunnelStatus
+	oldWanted  []string
+	debouncer  *statusDebouncer
+	checked    bool
+	stateStore *StateStore
+	driftMode  string
+	drifted    bool
 
-	addressConfiguration map[TunnelStatus][]string
-	oldStatus            TunnelStatus
+	restoreOnExit     bool
+	shutdownAddresses []string
+	// originalAddresses are restored on exit if restoreOnExit is set
+	originalAddresses []string
+
+	// sourceSettings are the settings the status sources have been built from, they can not be changed by reloading
+	// the config
+	sourceSettings sourceSettings
+	// sources are the status sources with defaults applied
+	sources  []SourceConfig
+	watchdog *LockoutWatchdog
+	firewall Firewall
+	// restrictedAddresses are the addresses access is restricted to allow-listed sources for, nil if unrestricted
+	restrictedAddresses []string
+	// overrideAddresses override the wanted addresses until the status changes, after ssh could not be confirmed
+	// reachable on the addresses for status up or did not listen on the wanted addresses
+	overrideAddresses []string
 }
 
-func NewSshAegis(configWrapper ConfigWrapper, tunnelStatusSource TunnelStatusSource, serviceProvider ServiceReloader, options *SshAegisConfig) (*SshAegis, error) {
+func NewSshAegis(configWrapper ConfigWrapper, tunnelStatusSource TunnelStatusSource, serviceProvider ServiceReloader, configValidator ConfigValidator, options *SshAegisConfig) (*SshAegis, error) {
 	if configWrapper == nil {
 		return nil, errors.New("no ssh config wrapper provided")
 	}
@@ -46,46 +114,576 @@ func NewSshAegis(configWrapper ConfigWrapper, tunnelStatusSource TunnelStatusSou
 		return nil, errors.New("nil options provided")
 	}
 
+	rules, err := options.addressRules()
+	if err != nil {
+		return nil, err
+	}
+
 	return &SshAegis{
 		configWrapper:      configWrapper,
 		tunnelStatusSource: tunnelStatusSource,
 		serviceProvider:    serviceProvider,
+		configValidator:    configValidator,
 		oldStatus:          Unknown,
-		addressConfiguration: map[TunnelStatus][]string{
-			Up:      options.ListenAddressesUp,
-			Down:    options.ListenAddressesDown,
-			Unknown: options.ListenAddressesUnknown,
-		},
+		debouncer:          newStatusDebouncer(options.transitionThresholds()),
+		rules:              rules,
+		sourceSettings:     options.sourceSettings(),
+		sources:            options.sources(),
+		driftMode:          options.DriftMode,
+		restoreOnExit:      options.RestoreOnExit,
+		shutdownAddresses:  options.ListenAddressesShutdown,
 	}, nil
 }
 
+// Check reads the status on the regular check interval and applies the addresses for it.
 func (s *SshAegis) Check() {
+	s.check(true)
+}
+
+// CheckOnEvent reads the status after an event, such as a change of a watched interface. Unlike readings taken by
+// Check, these readings do not count towards the number of readings required by transition thresholds.
+func (s *SshAegis) CheckOnEvent() {
+	s.check(false)
+}
+
+func (s *SshAegis) check(scheduled bool) {
 	status := s.tunnelStatusSource.GetStatus()
+	// the very first reading is not debounced, as there is no previous status to stick to
+	if s.checked && s.debouncer != nil {
+		status = s.debouncer.Observe(s.oldStatus, status, scheduled)
+	}
+	s.checked = true
 	metrics.Status = status
 
 	if s.oldStatus != status {
 		slog.Info("Status changed", "from", s.oldStatus, "to", status)
 		s.oldStatus = status
+		s.liftOverride()
 		if err := s.upsert(status); err != nil {
 			slog.Error("could not upsert status", "err", err)
 		}
 
 		metrics.LastStatusChange = time.Now().Unix()
+		s.saveState()
+		return
+	}
+
+	if s.superviseLockout() {
+		s.saveState()
+		return
+	}
+
+	// rules depending on individual sources may want different addresses while the combined status stays the same
+	if wanted := s.wantedAddresses(status); len(wanted) > 0 && !sameListenAddresses(wanted, s.oldWanted) {
+		slog.Info("Wanted addresses changed", "status", status, "from", s.oldWanted, "to", wanted)
+		if err := s.upsert(status); err != nil {
+			slog.Error("could not upsert status", "err", err)
+		}
+		s.saveState()
+		return
+	}
+
+	s.refreshRestriction()
+	s.reconcile(status)
+}
+
+// superviseLockout reverts to the addresses for status down if ssh could not be confirmed reachable on the addresses
+// for status up in time. The reverted addresses are kept until the status changes. It returns true if the addresses
+// have been reverted.
+func (s *SshAegis) superviseLockout() bool {
+	if s.watchdog == nil || !s.watchdog.armed() {
+		return false
+	}
+
+	switch s.watchdog.observe() {
+	case lockoutPending:
+		return false
+	case lockoutConfirmed:
+		s.saveState()
+		return false
+	}
+
+	fallback := s.rules.fallbackAddresses()
+	if len(fallback) == 0 {
+		slog.Error("Could not confirm ssh is reachable, but there are no addresses to revert to")
+		return false
+	}
+
+	metrics.LockoutReverts++
+	metrics.LockoutActive = 1
+	slog.Error("Could not confirm ssh is reachable, reverting to addresses for status 'down' until the status changes", "addresses", fallback)
+	s.overrideAddresses = fallback
+	s.restrictAccess(fallback)
+	if err := s.applyAddresses(fallback); err != nil {
+		slog.Error("could not revert addresses", "err", err)
+	}
+	return true
+}
+
+// liftOverride removes the override set by superviseLockout or fallback and stops waiting for evidence of ssh being
+// reachable.
+func (s *SshAegis) liftOverride() {
+	if s.watchdog != nil {
+		s.watchdog.disarm()
+	}
+
+	if s.overrideAddresses != nil {
+		slog.Info("Lifting override of wanted addresses", "addresses", s.overrideAddresses)
+		s.overrideAddresses = nil
+	}
+	metrics.LockoutActive = 0
+}
+
+// reconcile compares the ListenAddress directives sshd applies with the addresses wanted for the given status, as the
+// sshd config may have been edited externally, e.g. by a package upgrade or configuration management. Depending on the
+// drift mode, drift is either repaired or only reported.
+func (s *SshAegis) reconcile(status TunnelStatus) {
+	if s.driftMode != driftModeRepair && s.driftMode != driftModeAlert {
+		return
+	}
+
+	wanted := s.wantedAddresses(status)
+	if len(wanted) == 0 {
+		s.setDrifted(false)
+		return
+	}
+
+	data, err := s.configWrapper.GetConfig()
+	if err != nil {
+		metrics.ConfigReadErrors++
+		slog.Error("could not check for config drift", "err", err)
+		return
+	}
+
+	// ListenAddress directives added via included files change what sshd listens on as well
+	configured, err := s.getEffectiveListenAddresses(data)
+	if err != nil {
+		metrics.ConfigReadErrors++
+		slog.Error("could not check for config drift", "err", err)
+		return
+	}
+	if sameListenAddresses(configured, wanted) {
+		if s.drifted {
+			slog.Info("Config drift resolved", "addresses", wanted)
+		}
+		s.setDrifted(false)
+		return
+	}
+
+	// drift caused by included files can not be repaired by rewriting the managed config, only alert on it
+	if sameListenAddresses(getConfiguredListenAddresses(data), wanted) {
+		if !s.drifted {
+			slog.Warn("Detected config drift outside of the managed config, can not repair", "wanted", wanted, "configured", configured)
+		}
+		s.setDrifted(true)
+		return
+	}
+
+	if !s.drifted || s.driftMode == driftModeRepair {
+		slog.Warn("Detected config drift", "wanted", wanted, "configured", configured, "mode", s.driftMode)
+	}
+	s.setDrifted(true)
+	if s.driftMode != driftModeRepair {
+		return
+	}
+
+	metrics.DriftRepairs++
+	if err := s.upsert(status); err != nil {
+		slog.Error("could not repair config drift", "err", err)
+		s.saveState()
+		return
+	}
+
+	s.setDrifted(false)
+	s.saveState()
+}
+
+func (s *SshAegis) setDrifted(drifted bool) {
+	s.drifted = drifted
+	metrics.ConfigDrift = 0
+	if drifted {
+		metrics.ConfigDrift = 1
+	}
+}
+
+// wantedAddresses evaluates the rules for the given combined status and the status of the individual sources of the
+// last reading.
+func (s *SshAegis) wantedAddresses(status TunnelStatus) []string {
+	if s.overrideAddresses != nil {
+		return s.overrideAddresses
+	}
+
+	sources := s.sourceStatuses()
+	idx, addresses := s.rules.evaluate(status, sources)
+	if idx < 0 {
+		slog.Warn("No rule matches, keeping current addresses", "status", status, "sources", sources)
+		return nil
+	}
+
+	slog.Debug("Rule matches", "rule", idx+1, "status", status, "sources", sources, "addresses", addresses)
+	return addresses
+}
+
+// sourceStatuses returns the status of the individual sources of the last reading. If the rules refer to sources that
+// have not been read yet, e.g. because the status has been forced, the sources are read once, as they would be treated
+// as unknown otherwise.
+func (s *SshAegis) sourceStatuses() map[string]TunnelStatus {
+	reporter, ok := s.tunnelStatusSource.(SourceStatusReporter)
+	if !ok {
+		return nil
+	}
+
+	if len(reporter.SourceStatuses()) == 0 && s.rules.referencesSources() {
+		slog.Debug("Reading sources to evaluate rules")
+		s.tunnelStatusSource.GetStatus()
+	}
+
+	return reporter.SourceStatuses()
+}
+
+// ReadStatus returns the current reading of the status source without debouncing.
+func (s *SshAegis) ReadStatus() TunnelStatus {
+	return s.tunnelStatusSource.GetStatus()
+}
+
+// Apply applies the addresses configured for the given status once, without debouncing. Unlike Check, the sshd
+// config is reconciled even if the status did not change.
+func (s *SshAegis) Apply(status TunnelStatus) error {
+	s.checked = true
+	metrics.Status = status
+
+	changed := s.oldStatus != status
+	if changed {
+		slog.Info("Status changed", "from", s.oldStatus, "to", status)
+		s.oldStatus = status
+	}
+
+	err := s.upsert(status)
+	if changed {
+		metrics.LastStatusChange = time.Now().Unix()
+	}
+	s.saveState()
+
+	return err
+}
+
+// Plan applies the addresses configured for the given status without debouncing. It returns whether the sshd config
+// needs to be changed. Plan does not roll back, it's meant to be used with a dry-run ConfigWrapper and
+// ServiceReloader that report the changes rather than applying them.
+func (s *SshAegis) Plan(status TunnelStatus) (bool, error) {
+	metrics.Status = status
+	slog.Info("Planning changes", "status", status)
+
+	wanted := s.wantedAddresses(status)
+	if len(wanted) == 0 {
+		slog.Info("No addresses configured for status, nothing to do", "status", status)
+		return false, nil
+	}
+
+	updateNeeded, err := s.isUpdateNeeded(wanted)
+	if err != nil || !updateNeeded {
+		return false, err
+	}
+
+	if err := s.setConfiguredListenAddresses(wanted); err != nil {
+		return true, err
+	}
+
+	return true, s.serviceProvider.RestartSsh()
+}
+
+// RestoreState loads the persisted state and continues from the persisted status. If the addresses in the sshd
+// config do not match the addresses wanted for the persisted status, the next check starts from scratch.
+func (s *SshAegis) RestoreState() error {
+	if s.stateStore == nil {
+		return nil
+	}
+
+	state, err := s.stateStore.Load()
+	if err != nil || state == nil {
+		return err
+	}
+
+	if s.restoreOnExit && state.OriginalAddresses != nil {
+		s.originalAddresses = state.OriginalAddresses
+	}
+
+	status, found := parseTunnelStatus(state.Status)
+	if !found {
+		return fmt.Errorf("invalid status %q in persisted state", state.Status)
+	}
+
+	slog.Info("Restored state", "status", status, "last_status_change", time.Unix(state.LastStatusChange, 0), "addresses", state.Addresses)
+	metrics.LastStatusChange = state.LastStatusChange
+	metrics.Status = status
+
+	data, err := s.configWrapper.GetConfig()
+	if err != nil {
+		metrics.ConfigReadErrors++
+		return err
+	}
+
+	configured := normalizeListenAddresses(getConfiguredListenAddresses(data))
+	metrics.ListenAddresses = configured
+	s.oldWanted = configured
+	if !sameListenAddresses(configured, state.Addresses) {
+		slog.Warn("Addresses in sshd config differ from persisted addresses", "configured", configured, "persisted", state.Addresses)
+	}
+
+	wanted := s.wantedAddresses(status)
+	if len(wanted) > 0 && !sameListenAddresses(configured, wanted) {
+		slog.Warn("Addresses in sshd config do not match persisted status, reconciling on next check", "status", status, "wanted", wanted)
+		return nil
+	}
+
+	s.oldStatus = status
+	s.checked = true
+	if status == Down && s.firewall != nil {
+		s.restrictedAddresses = configured
+		metrics.FirewallRestricted = 1
+	}
+
+	// a previous run may have been stopped before ssh was confirmed reachable on the addresses for status up
+	if status == Up && s.watchdog != nil && len(wanted) > 0 {
+		if state.LockoutConfirmed {
+			s.watchdog.restore(wanted)
+		} else {
+			s.watchdog.arm(wanted)
+		}
+	}
+	return nil
+}
+
+func (s *SshAegis) saveState() {
+	if s.stateStore == nil {
+		return
+	}
+
+	data, err := s.configWrapper.GetConfig()
+	if err != nil {
+		metrics.ConfigReadErrors++
+		slog.Error("could not read config for persisting state", "err", err)
+		return
+	}
+
+	state := State{
+		Status:            s.oldStatus.String(),
+		LastStatusChange:  metrics.LastStatusChange,
+		Addresses:         normalizeListenAddresses(getConfiguredListenAddresses(data)),
+		OriginalAddresses: s.originalAddresses,
+		LockoutConfirmed:  s.watchdog != nil && s.watchdog.confirmed,
 	}
+
+	if err := s.stateStore.Save(state); err != nil {
+		metrics.StateWriteErrors++
+		slog.Error("could not persist state", "err", err)
+	}
+}
+
+// SnapshotListenAddresses saves the configured addresses to restore them on exit, if restore_on_exit is enabled.
+// Addresses restored from the persisted state take precedence, as the config may still contain addresses written by a
+// previous run that was not stopped gracefully.
+func (s *SshAegis) SnapshotListenAddresses() error {
+	if !s.restoreOnExit || s.originalAddresses != nil {
+		return nil
+	}
+
+	data, err := s.configWrapper.GetConfig()
+	if err != nil {
+		metrics.ConfigReadErrors++
+		return err
+	}
+
+	s.originalAddresses = normalizeListenAddresses(getConfiguredListenAddresses(data))
+	slog.Info("Saved addresses to restore on exit", "addresses", s.originalAddresses)
+	return nil
+}
+
+// Shutdown applies the addresses configured for shutdown or, if there are none, restores the addresses saved by
+// SnapshotListenAddresses, and lifts any restriction of the firewall. It does nothing unless restore_on_exit is
+// enabled.
+func (s *SshAegis) Shutdown() error {
+	if !s.restoreOnExit {
+		return nil
+	}
+
+	// ssh-aegis does not manage the firewall anymore after exiting
+	defer s.liftRestriction()
+
+	if len(s.shutdownAddresses) > 0 {
+		slog.Info("Applying addresses for shutdown", "addresses", s.shutdownAddresses)
+		err := s.applyAddresses(s.shutdownAddresses)
+		s.saveState()
+		return err
+	}
+
+	if s.originalAddresses == nil {
+		return errors.New("no addresses saved to restore")
+	}
+
+	slog.Info("Restoring original addresses", "addresses", s.originalAddresses)
+	if err := s.applyAddresses(s.originalAddresses); err != nil {
+		s.saveState()
+		return err
+	}
+
+	// the config is back to its original state, the next run takes a fresh snapshot
+	s.originalAddresses = nil
+	s.saveState()
+	return nil
+}
+
+// verifyReloadable returns an error if the given config changes settings that can not be reloaded. The status sources
+// are built on startup, so rules referring to added sources could never match.
+func (s *SshAegis) verifyReloadable(options *SshAegisConfig) error {
+	if !reflect.DeepEqual(options.sourceSettings(), s.sourceSettings) {
+		return errors.New("sources can not be changed by reloading the config, restart ssh-aegis instead")
+	}
+
+	return nil
+}
+
+// updateInterfaceAddresses passes changed addresses to interface sources, as they default to the addresses for status
+// up which can be reloaded.
+func (s *SshAegis) updateInterfaceAddresses(sources []SourceConfig) error {
+	for idx, source := range sources {
+		if source.Type != sourceTypeInterface || slices.Equal(source.InterfaceAddresses, s.sources[idx].InterfaceAddresses) {
+			continue
+		}
+
+		setter, ok := s.tunnelStatusSource.(InterfaceAddressSetter)
+		if !ok {
+			return fmt.Errorf("can not update addresses of interface source %q", source.Name)
+		}
+
+		slog.Info("Updating addresses of interface source", "source", source.Name, "addresses", source.InterfaceAddresses)
+		if err := setter.SetInterfaceAddresses(source.Name, source.InterfaceAddresses); err != nil {
+			return err
+		}
+	}
+
+	s.sources = sources
+	return nil
+}
+
+// Reload replaces the address rules, transition thresholds, drift mode and shutdown addresses and applies the
+// addresses configured for the current status. It's not safe to be called concurrently with Check.
+func (s *SshAegis) Reload(options *SshAegisConfig) error {
+	if options == nil {
+		return errors.New("nil options provided")
+	}
+
+	if err := s.verifyReloadable(options); err != nil {
+		return err
+	}
+
+	rules, err := options.addressRules()
+	if err != nil {
+		return err
+	}
+
+	if err := s.updateInterfaceAddresses(options.sources()); err != nil {
+		return err
+	}
+
+	s.rules = rules
+	s.debouncer = newStatusDebouncer(options.transitionThresholds())
+	s.driftMode = options.DriftMode
+	s.shutdownAddresses = options.ListenAddressesShutdown
+
+	if !s.checked {
+		return nil
+	}
+
+	slog.Info("Applying reloaded config", "status", s.oldStatus)
+	err = s.upsert(s.oldStatus)
+	s.saveState()
+	return err
 }
 
 func (s *SshAegis) upsert(status TunnelStatus) error {
-	if status == Unknown && len(s.addressConfiguration[Unknown]) == 0 {
-		slog.Debug("Ignoring status 'unknown'")
+	wanted := s.wantedAddresses(status)
+	if len(wanted) == 0 {
+		slog.Debug("No addresses configured, keeping current addresses", "status", status)
 		return nil
 	}
 
-	wanted := s.addressConfiguration[status]
+	// restrict access before opening up ssh, but only lift the restriction after ssh does not listen publicly anymore
+	if status == Down {
+		s.restrictAccess(wanted)
+	}
+
+	if err := s.applyAddresses(wanted); err != nil {
+		return err
+	}
+
+	if status != Down && s.overrideAddresses == nil {
+		s.liftRestriction()
+	}
+
+	// the addresses may have been applied already by a one-shot run, e.g. from a hook, so the watchdog is armed even if
+	// ssh has not been switched right now
+	if status == Up && s.watchdog != nil && s.overrideAddresses == nil {
+		s.watchdog.arm(wanted)
+	}
+	return nil
+}
+
+// restrictAccess only allows allow-listed sources to reach ssh. Errors are not fatal, as ssh needs to be reachable
+// while the tunnel is down, the restriction is retried on the next check.
+func (s *SshAegis) restrictAccess(addresses []string) {
+	if s.firewall == nil {
+		return
+	}
+
+	s.restrictedAddresses = addresses
+	s.refreshRestriction()
+}
+
+func (s *SshAegis) liftRestriction() {
+	if s.firewall == nil {
+		return
+	}
+
+	if err := s.firewall.Lift(); err != nil {
+		metrics.FirewallErrors++
+		slog.Error("could not lift restricted access to ssh", "err", err)
+		return
+	}
+	s.restrictedAddresses = nil
+	metrics.FirewallRestricted = 0
+}
+
+// refreshRestriction applies the restriction again, so changed addresses of allow-listed hostnames are picked up and
+// failed attempts are retried.
+func (s *SshAegis) refreshRestriction() {
+	if s.firewall == nil || s.restrictedAddresses == nil {
+		return
+	}
+
+	if err := s.firewall.Restrict(s.restrictedAddresses); err != nil {
+		metrics.FirewallErrors++
+		slog.Error("could not restrict access to ssh", "err", err)
+		return
+	}
+	metrics.FirewallRestricted = 1
+}
+
+// applyAddresses writes the given addresses to the sshd config and restarts ssh, if the config does not contain them
+// already.
+func (s *SshAegis) applyAddresses(wanted []string) error {
+	s.oldWanted = wanted
 	updateNeeded, err := s.isUpdateNeeded(wanted)
 	if err != nil {
 		return err
 	}
 	if updateNeeded {
+		previous, err := s.configWrapper.GetConfig()
+		if err != nil {
+			metrics.ConfigReadErrors++
+			return err
+		}
+
 		slog.Info("Updating ListenAddress configuration", "addresses", wanted)
 		if err := s.setConfiguredListenAddresses(wanted); err != nil {
 			return err
@@ -93,14 +691,87 @@ func (s *SshAegis) upsert(status TunnelStatus) error {
 
 		if err := s.serviceProvider.RestartSsh(); err != nil {
 			metrics.RestartSshErrors++
+			slog.Error("could not restart ssh, rolling back to previous config", "err", err)
+			return errors.Join(err, s.rollback(previous))
+		}
+
+		if err := s.verifyListening(wanted); err != nil {
+			slog.Error("ssh is not listening on the wanted addresses, falling back", "err", err)
+			return errors.Join(err, s.fallback(wanted))
 		}
 	} else {
 		slog.Info("No updates needed")
 	}
 
+	metrics.ListenAddresses = wanted
 	return nil
 }
 
+// rollback restores the given config and restarts ssh again, so ssh keeps running with its last working config.
+func (s *SshAegis) rollback(previous []string) error {
+	metrics.ConfigRollbacks++
+	if err := s.configWrapper.WriteConfig(previous); err != nil {
+		metrics.ConfigWriteErrors++
+		metrics.ConfigRollbackErrors++
+		return fmt.Errorf("could not restore previous config: %w", err)
+	}
+
+	if err := s.serviceProvider.RestartSsh(); err != nil {
+		metrics.RestartSshErrors++
+		metrics.ConfigRollbackErrors++
+		return fmt.Errorf("could not restart ssh after restoring previous config: %w", err)
+	}
+
+	slog.Info("Restored previous config")
+	return nil
+}
+
+func (s *SshAegis) verifyListening(addresses []string) error {
+	if s.listenVerifier == nil {
+		return nil
+	}
+
+	if err := s.listenVerifier.VerifyListening(addresses); err != nil {
+		metrics.ListenMismatches++
+		return err
+	}
+
+	return nil
+}
+
+// fallback applies the addresses configured for status down after ssh failed to listen on the wanted addresses. The
+// fallback addresses are kept until the status changes, so ssh is not restarted over and over again.
+func (s *SshAegis) fallback(failed []string) error {
+	fallback := s.rules.fallbackAddresses()
+	if len(fallback) == 0 || sameListenAddresses(fallback, failed) {
+		return errors.New("no addresses to fall back to")
+	}
+
+	metrics.ListenFallbacks++
+	s.oldWanted = fallback
+	s.overrideAddresses = fallback
+	slog.Warn("Falling back to addresses for status 'down' until the status changes", "addresses", fallback)
+	s.restrictAccess(fallback)
+	if err := s.setConfiguredListenAddresses(fallback); err != nil {
+		return fmt.Errorf("could not fall back: %w", err)
+	}
+
+	if err := s.serviceProvider.RestartSsh(); err != nil {
+		metrics.RestartSshErrors++
+		return fmt.Errorf("could not restart ssh after falling back: %w", err)
+	}
+
+	if err := s.verifyListening(fallback); err != nil {
+		return fmt.Errorf("ssh is not listening on fallback addresses: %w", err)
+	}
+
+	metrics.ListenAddresses = fallback
+	return nil
+}
+
+// isUpdateNeeded returns whether the managed file needs to be updated. If the managed file contains the wanted
+// addresses already but sshd is configured to listen on other addresses via included files, an error is returned as
+// writing the managed file can not fix this.
 func (s *SshAegis) isUpdateNeeded(wantedListenAddresses []string) (bool, error) {
 	data, err := s.configWrapper.GetConfig()
 	if err != nil {
@@ -108,25 +779,70 @@ func (s *SshAegis) isUpdateNeeded(wantedListenAddresses []string) (bool, error)
 		return false, err
 	}
 	configuredListenAddresses := getConfiguredListenAddresses(data)
-	if len(configuredListenAddresses) != len(wantedListenAddresses) {
+	if !sameListenAddresses(configuredListenAddresses, wantedListenAddresses) {
 		return true, nil
 	}
 
-	for _, addr := range wantedListenAddresses {
-		if !slices.Contains(configuredListenAddresses, addr) {
-			return true, nil
-		}
+	effective, err := s.getEffectiveListenAddresses(data)
+	if err != nil {
+		metrics.ConfigReadErrors++
+		return false, err
+	}
+	if !sameListenAddresses(effective, wantedListenAddresses) {
+		return false, fmt.Errorf("sshd listens on %v due to ListenAddress directives outside of the managed file", effective)
 	}
 
 	return false, nil
 }
 
+// getEffectiveListenAddresses returns the addresses of all ListenAddress directives sshd applies, including those of
+// included files. If the config wrapper can not read the effective config, only the given managed lines are used.
+func (s *SshAegis) getEffectiveListenAddresses(managed []string) ([]string, error) {
+	reader, ok := s.configWrapper.(EffectiveConfigReader)
+	if !ok {
+		return getConfiguredListenAddresses(managed), nil
+	}
+
+	lines, err := reader.GetEffectiveConfig()
+	if err != nil {
+		return nil, fmt.Errorf("could not read effective sshd config: %w", err)
+	}
+
+	var addresses []string
+	for _, line := range lines {
+		if isManagedListenAddress(line) {
+			addresses = append(addresses, strings.Join(line.Args, " "))
+		}
+	}
+
+	return addresses, nil
+}
+
+// sameListenAddresses compares two sets of listen addresses, disregarding their order and notation.
+func sameListenAddresses(a, b []string) bool {
+	a = normalizeListenAddresses(a)
+	b = normalizeListenAddresses(b)
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, addr := range b {
+		if !slices.Contains(a, addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (s *SshAegis) setConfiguredListenAddresses(wanted []string) error {
 	data, err := s.configWrapper.GetConfig()
 	if err != nil {
 		metrics.ConfigReadErrors++
 		return err
 	}
+	// work on a copy, the config wrapper may hand out its internal state
+	data = slices.Clone(data)
 
 	// get indices of lines containing active ListenAddress configuration and then remove these indices from the slice
 	listenAddressConfigLinesIndices := getListenAddressIndices(data)
@@ -139,7 +855,7 @@ func (s *SshAegis) setConfiguredListenAddresses(wanted []string) error {
 
 	insertBlock := make([]string, len(wanted))
 	for idx, wantedIp := range wanted {
-		insertBlock[idx] = fmt.Sprintf("%s%s", listenAddressConfiguration, wantedIp)
+		insertBlock[idx] = fmt.Sprintf("%s%s", listenAddressConfiguration, normalizeListenAddress(wantedIp))
 	}
 
 	index := 0
@@ -148,6 +864,13 @@ func (s *SshAegis) setConfiguredListenAddresses(wanted []string) error {
 	}
 	data = slices.Insert(data, index, insertBlock...)
 
+	if s.configValidator != nil {
+		if err := s.configValidator.ValidateConfig(data); err != nil {
+			metrics.ConfigValidationErrors++
+			return fmt.Errorf("refusing to write invalid config: %w", err)
+		}
+	}
+
 	if err := s.configWrapper.WriteConfig(data); err != nil {
 		metrics.ConfigWriteErrors++
 		return err
@@ -156,24 +879,40 @@ func (s *SshAegis) setConfiguredListenAddresses(wanted []string) error {
 	return nil
 }
 
+// getConfiguredListenAddresses returns the arguments of all ListenAddress directives outside of Match blocks.
 func getConfiguredListenAddresses(data []string) []string {
 	var addresses []string
-	for _, line := range data {
-		if strings.HasPrefix(line, listenAddressConfiguration) {
-			addresses = append(addresses, strings.ReplaceAll(line, listenAddressConfiguration, ""))
+	for _, line := range parseSshdConfig("", data) {
+		if isManagedListenAddress(line) {
+			addresses = append(addresses, strings.Join(line.Args, " "))
 		}
 	}
 
 	return addresses
 }
 
+// getListenAddressIndices returns the indices of all lines containing ListenAddress directives outside of Match
+// blocks.
 func getListenAddressIndices(lines []string) []int {
 	var indices []int
-	for i, line := range lines {
-		if strings.HasPrefix(line, listenAddressConfiguration) {
+	for i, line := range parseSshdConfig("", lines) {
+		if isManagedListenAddress(line) {
 			indices = append(indices, i)
 		}
 	}
 
 	return indices
 }
+
+func normalizeListenAddresses(addresses []string) []string {
+	ret := make([]string, len(addresses))
+	for idx, addr := range addresses {
+		ret[idx] = normalizeListenAddress(addr)
+	}
+
+	return ret
+}
+
+func isManagedListenAddress(line sshdConfigLine) bool {
+	return line.Keyword == sshdKeywordListenAddress && !line.InMatch && len(line.Args) > 0
+}
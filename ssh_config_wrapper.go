@@ -1,48 +1,78 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"fmt"
+	"log/slog"
 	"os"
+	"strings"
 )
 
+const sshConfigDefaultMode = 0o644
+
 type SshConfigWrapper struct {
 	sshConfigFile string
+	fs            fileSystem
+	// includeDir is the dir relative include paths are resolved against, defaults to sshdIncludeDir
+	includeDir string
 }
 
 func (s *SshConfigWrapper) GetConfig() ([]string, error) {
-	inputFile, err := os.Open(s.sshConfigFile)
+	return readLines(s.sshConfigFile)
+}
+
+// GetEffectiveConfig returns the config including all files included by it.
+func (s *SshConfigWrapper) GetEffectiveConfig() ([]sshdConfigLine, error) {
+	return loadSshdConfig(s.sshConfigFile, includeDirOrDefault(s.includeDir))
+}
+
+// Verify warns about ListenAddress directives that are not managed by ssh-aegis, either because they are part of an
+// included file or because they are placed in a Match block, which sshd does not permit.
+func (s *SshConfigWrapper) Verify() error {
+	effective, err := loadSshdConfig(s.sshConfigFile, includeDirOrDefault(s.includeDir))
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("could not read effective sshd config: %w", err)
 	}
-	defer inputFile.Close()
 
-	var lines []string
-	scanner := bufio.NewScanner(inputFile)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
-	}
+	for _, line := range effective {
+		if line.Keyword != sshdKeywordListenAddress {
+			continue
+		}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+		if line.File != s.sshConfigFile {
+			slog.Warn("Found ListenAddress in included file, sshd merges it with the managed addresses",
+				"file", line.File, "line", line.LineNo, "address", strings.Join(line.Args, " "))
+		} else if line.InMatch {
+			slog.Warn("Found ListenAddress within Match block, which sshd does not permit",
+				"file", line.File, "line", line.LineNo, "address", strings.Join(line.Args, " "))
+		}
 	}
 
-	return lines, nil
+	return nil
 }
 
-// WriteFile writes the modified contents back to the file
+// hasFinalNewline returns false if the file exists and its last line is not terminated by a newline.
+func hasFinalNewline(file string) bool {
+	data, err := os.ReadFile(file)
+	return err != nil || len(data) == 0 || data[len(data)-1] == '\n'
+}
+
+// WriteConfig atomically replaces the config file with the given lines, preserving the file's mode, owner and
+// security context.
 func (s *SshConfigWrapper) WriteConfig(data []string) error {
-	outputFile, err := os.Create(s.sshConfigFile)
-	if err != nil {
-		return err
+	var buf bytes.Buffer
+	for _, line := range data {
+		buf.WriteString(line + "\n")
+	}
+	// keep a missing final newline, so untouched lines are written back byte for byte
+	if buf.Len() > 0 && !hasFinalNewline(s.sshConfigFile) {
+		buf.Truncate(buf.Len() - 1)
 	}
-	defer outputFile.Close()
 
-	writer := bufio.NewWriter(outputFile)
-	for _, line := range data {
-		_, err := writer.WriteString(line + "\n")
-		if err != nil {
-			return err
-		}
+	var fsys fileSystem = osFileSystem{}
+	if s.fs != nil {
+		fsys = s.fs
 	}
-	return writer.Flush()
+
+	return writeFileAtomic(fsys, s.sshConfigFile, buf.Bytes(), sshConfigDefaultMode)
 }
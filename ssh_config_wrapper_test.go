@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -85,3 +86,48 @@ func TestSshConfigWrapper_WriteConfig(t *testing.T) {
 		t.Errorf("written data does not match expected data: written=%v, read=%v", data, read)
 	}
 }
+
+func TestSshConfigWrapper_WriteConfigRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "final newline",
+			content: "Port 22\nListenAddress 0.0.0.0\n",
+		},
+		{
+			name:    "no final newline",
+			content: "Port 22\nListenAddress 0.0.0.0",
+		},
+		{
+			name:    "blank last line",
+			content: "Port 22\nListenAddress 0.0.0.0\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "sshd_config")
+			if err := os.WriteFile(file, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			s := &SshConfigWrapper{sshConfigFile: file}
+			lines, err := s.GetConfig()
+			if err != nil {
+				t.Fatalf("GetConfig() error = %v", err)
+			}
+			if err := s.WriteConfig(lines); err != nil {
+				t.Fatalf("WriteConfig() error = %v", err)
+			}
+
+			got, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.content {
+				t.Errorf("WriteConfig() wrote %q, want %q", got, tt.content)
+			}
+		})
+	}
+}
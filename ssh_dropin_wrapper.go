@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const dropInHeader = "# Managed by ssh-aegis, manual changes will be overwritten"
+
+// SshDropInWrapper manages a dedicated drop-in file that is included by the main sshd config, leaving the main sshd
+// config untouched.
+type SshDropInWrapper struct {
+	mainConfigFile string
+	dropIn         *SshConfigWrapper
+	// includeDir is the dir relative include paths are resolved against, defaults to sshdIncludeDir
+	includeDir string
+}
+
+func NewSshDropInWrapper(mainConfigFile string, dropInFile string) (*SshDropInWrapper, error) {
+	if mainConfigFile == "" {
+		return nil, errors.New("empty main config file provided")
+	}
+
+	if dropInFile == "" {
+		return nil, errors.New("empty drop-in file provided")
+	}
+
+	return &SshDropInWrapper{
+		mainConfigFile: mainConfigFile,
+		dropIn:         &SshConfigWrapper{sshConfigFile: dropInFile},
+	}, nil
+}
+
+func (s *SshDropInWrapper) GetConfig() ([]string, error) {
+	lines, err := s.dropIn.GetConfig()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	return lines, err
+}
+
+// GetEffectiveConfig returns the main config including all files included by it, such as the drop-in.
+func (s *SshDropInWrapper) GetEffectiveConfig() ([]sshdConfigLine, error) {
+	return loadSshdConfig(s.mainConfigFile, includeDirOrDefault(s.includeDir))
+}
+
+func (s *SshDropInWrapper) WriteConfig(data []string) error {
+	return s.dropIn.WriteConfig(s.RenderConfig(data))
+}
+
+// RenderConfig puts the header in front of the data, regardless of whether the data already contains it.
+func (s *SshDropInWrapper) RenderConfig(data []string) []string {
+	data = slices.DeleteFunc(slices.Clone(data), func(line string) bool {
+		return line == dropInHeader
+	})
+
+	return append([]string{dropInHeader}, data...)
+}
+
+// Verify makes sure the drop-in file is included unconditionally by the main sshd config and warns about
+// ListenAddress directives in other files, as sshd merges all ListenAddress directives it encounters.
+func (s *SshDropInWrapper) Verify() error {
+	lines, err := readLines(s.mainConfigFile)
+	if err != nil {
+		return fmt.Errorf("could not read main sshd config: %w", err)
+	}
+
+	baseDir := includeDirOrDefault(s.includeDir)
+	included := false
+	for _, line := range parseSshdConfig(s.mainConfigFile, lines) {
+		// directives after the first Match block are only applied conditionally
+		if line.Keyword != sshdKeywordInclude || line.InMatch {
+			continue
+		}
+
+		for _, pattern := range line.Args {
+			if matched, _ := filepath.Match(resolveIncludePattern(pattern, baseDir), s.dropIn.sshConfigFile); matched {
+				included = true
+			}
+		}
+	}
+
+	if !included {
+		return fmt.Errorf("drop-in %q is not included by %q before its first Match block", s.dropIn.sshConfigFile, s.mainConfigFile)
+	}
+
+	effective, err := loadSshdConfig(s.mainConfigFile, baseDir)
+	if err != nil {
+		return fmt.Errorf("could not read effective sshd config: %w", err)
+	}
+
+	for _, line := range effective {
+		if line.Keyword == sshdKeywordListenAddress && line.File != s.dropIn.sshConfigFile {
+			slog.Warn("Found ListenAddress outside of drop-in, sshd merges it with the managed addresses",
+				"file", line.File, "line", line.LineNo, "address", strings.Join(line.Args, " "))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSshDropInWrapper_Verify(t *testing.T) {
+	tests := []struct {
+		name       string
+		mainConfig string
+		wantErr    bool
+	}{
+		{
+			name:       "included via relative glob",
+			mainConfig: "Include sshd_config.d/*.conf\nPort 22\n",
+			wantErr:    false,
+		},
+		{
+			name:       "included via absolute path",
+			mainConfig: "include %DIR%/sshd_config.d/00-ssh-aegis.conf\n",
+			wantErr:    false,
+		},
+		{
+			name:       "included with other files",
+			mainConfig: "Include /nonexistent/*.conf sshd_config.d/*.conf\nListenAddress 0.0.0.0\n",
+			wantErr:    false,
+		},
+		{
+			name:       "not included",
+			mainConfig: "Port 22\nListenAddress 0.0.0.0\n",
+			wantErr:    true,
+		},
+		{
+			name:       "glob not matching",
+			mainConfig: "Include sshd_config.d/*.config\n",
+			wantErr:    true,
+		},
+		{
+			name:       "only included within match block",
+			mainConfig: "Port 22\nMatch User root\n  Include sshd_config.d/*.conf\n",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.Mkdir(filepath.Join(dir, "sshd_config.d"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			mainConfigFile := filepath.Join(dir, "sshd_config")
+			mainConfig := strings.ReplaceAll(tt.mainConfig, "%DIR%", dir)
+			if err := os.WriteFile(mainConfigFile, []byte(mainConfig), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewSshDropInWrapper(mainConfigFile, filepath.Join(dir, "sshd_config.d", "00-ssh-aegis.conf"))
+			if err != nil {
+				t.Fatalf("NewSshDropInWrapper() error = %v", err)
+			}
+			s.includeDir = dir
+
+			if err := s.Verify(); (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSshDropInWrapper_GetConfigWriteConfig(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSshDropInWrapper(filepath.Join(dir, "sshd_config"), filepath.Join(dir, "00-ssh-aegis.conf"))
+	if err != nil {
+		t.Fatalf("NewSshDropInWrapper() error = %v", err)
+	}
+
+	got, err := s.GetConfig()
+	if err != nil {
+		t.Fatalf("GetConfig() on missing drop-in error = %v", err)
+	}
+	if got != nil {
+		t.Errorf("GetConfig() on missing drop-in = %v, want nil", got)
+	}
+
+	if err := s.WriteConfig([]string{"ListenAddress 10.8.0.1"}); err != nil {
+		t.Fatalf("WriteConfig() error = %v", err)
+	}
+
+	want := []string{dropInHeader, "ListenAddress 10.8.0.1"}
+	got, err = s.GetConfig()
+	if err != nil {
+		t.Fatalf("GetConfig() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetConfig() = %v, want %v", got, want)
+	}
+
+	// writing the header at another position must not duplicate it
+	if err := s.WriteConfig(append(got[1:], dropInHeader)); err != nil {
+		t.Fatalf("WriteConfig() error = %v", err)
+	}
+	got, _ = s.GetConfig()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetConfig() after rewrite = %v, want %v", got, want)
+	}
+}
+
+func TestSshDropInWrapper_VerifyRelativeToSshdDir(t *testing.T) {
+	dir := t.TempDir()
+	mainConfigFile := filepath.Join(dir, "sshd_config")
+	writeTestFile(t, mainConfigFile, "Include sshd_config.d/*.conf\n")
+
+	s, err := NewSshDropInWrapper(mainConfigFile, filepath.Join(dir, "sshd_config.d", "00-ssh-aegis.conf"))
+	if err != nil {
+		t.Fatalf("NewSshDropInWrapper() error = %v", err)
+	}
+
+	// sshd resolves the relative include against /etc/ssh, not against the dir of the main config
+	if err := s.Verify(); err == nil {
+		t.Errorf("Verify() expected error for drop-in outside of %s", sshdIncludeDir)
+	}
+}
+
+func TestSshDropInWrapper_DryRun(t *testing.T) {
+	dir := t.TempDir()
+	dropInFile := filepath.Join(dir, "00-ssh-aegis.conf")
+	s, err := NewSshDropInWrapper(filepath.Join(dir, "sshd_config"), dropInFile)
+	if err != nil {
+		t.Fatalf("NewSshDropInWrapper() error = %v", err)
+	}
+
+	out := &strings.Builder{}
+	if err := newDryRunConfigWrapper(s, dropInFile, out).WriteConfig([]string{"ListenAddress 10.8.0.1"}); err != nil {
+		t.Fatalf("WriteConfig() error = %v", err)
+	}
+
+	// the diff shows the file as it would be written, including the header
+	if !strings.Contains(out.String(), "+"+dropInHeader+"\n+ListenAddress 10.8.0.1\n") {
+		t.Errorf("WriteConfig() printed %q, want header and address added", out.String())
+	}
+	if _, err := os.Stat(dropInFile); !os.IsNotExist(err) {
+		t.Errorf("WriteConfig() created drop-in, stat error = %v", err)
+	}
+}
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func Test_getListenAddressIndices(t *testing.T) {
@@ -31,6 +37,22 @@ func Test_getListenAddressIndices(t *testing.T) {
 			},
 			want: []int{1, 4, 8},
 		},
+		{
+			name: "different spellings, match block ignored",
+			args: args{
+				lines: []string{
+					"# ListenAddress 9.9.9.9",
+					"listenaddress 1.2.3.4",
+					"  ListenAddress\t4.3.2.1",
+					"ListenAddress=::",
+					"LISTENADDRESS = 10.0.0.1 # trailing comment",
+					"ListenAddressFoo bar",
+					"Match User root",
+					"  ListenAddress 5.5.5.5",
+				},
+			},
+			want: []int{1, 2, 3, 4},
+		},
 		{
 			name: "no listen address",
 			args: args{
@@ -85,6 +107,26 @@ func Test_getConfiguredListenAddresses(t *testing.T) {
 				"::",
 			},
 		},
+		{
+			name: "different spellings, match block ignored",
+			args: args{
+				data: []string{
+					"# ListenAddress 9.9.9.9",
+					"listenaddress 1.2.3.4",
+					"  ListenAddress\t4.3.2.1",
+					"ListenAddress=::",
+					"LISTENADDRESS = 10.0.0.1 # trailing comment",
+					"Match User root",
+					"  ListenAddress 5.5.5.5",
+				},
+			},
+			want: []string{
+				"1.2.3.4",
+				"4.3.2.1",
+				"::",
+				"10.0.0.1",
+			},
+		},
 		{
 			name: "no listen addresses",
 			args: args{
@@ -124,11 +166,11 @@ func (d *dummyConfigWrapper) WriteConfig(data []string) error {
 
 func TestSshAegis_setConfiguredListenAddresses(t *testing.T) {
 	type fields struct {
-		configWrapper        ConfigWrapper
-		tunnelStatusSource   TunnelStatusSource
-		serviceProvider      ServiceReloader
-		addressConfiguration map[TunnelStatus][]string
-		oldStatus            TunnelStatus
+		configWrapper      ConfigWrapper
+		tunnelStatusSource TunnelStatusSource
+		serviceProvider    ServiceReloader
+		rules              addressRules
+		oldStatus          TunnelStatus
 	}
 	type args struct {
 		wanted []string
@@ -151,10 +193,10 @@ func TestSshAegis_setConfiguredListenAddresses(t *testing.T) {
 						"Other option",
 					},
 				},
-				tunnelStatusSource:   nil,
-				serviceProvider:      nil,
-				addressConfiguration: nil,
-				oldStatus:            0,
+				tunnelStatusSource: nil,
+				serviceProvider:    nil,
+				rules:              nil,
+				oldStatus:          0,
 			},
 			args: args{
 				wanted: []string{
@@ -181,10 +223,10 @@ func TestSshAegis_setConfiguredListenAddresses(t *testing.T) {
 						"ListenAddress 4.3.2.1",
 					},
 				},
-				tunnelStatusSource:   nil,
-				serviceProvider:      nil,
-				addressConfiguration: nil,
-				oldStatus:            0,
+				tunnelStatusSource: nil,
+				serviceProvider:    nil,
+				rules:              nil,
+				oldStatus:          0,
 			},
 			args: args{
 				wanted: []string{
@@ -209,10 +251,10 @@ func TestSshAegis_setConfiguredListenAddresses(t *testing.T) {
 						"Other option",
 					},
 				},
-				tunnelStatusSource:   nil,
-				serviceProvider:      nil,
-				addressConfiguration: nil,
-				oldStatus:            0,
+				tunnelStatusSource: nil,
+				serviceProvider:    nil,
+				rules:              nil,
+				oldStatus:          0,
 			},
 			args: args{
 				wanted: []string{
@@ -230,11 +272,11 @@ func TestSshAegis_setConfiguredListenAddresses(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := &SshAegis{
-				configWrapper:        tt.fields.configWrapper,
-				tunnelStatusSource:   tt.fields.tunnelStatusSource,
-				serviceProvider:      tt.fields.serviceProvider,
-				addressConfiguration: tt.fields.addressConfiguration,
-				oldStatus:            tt.fields.oldStatus,
+				configWrapper:      tt.fields.configWrapper,
+				tunnelStatusSource: tt.fields.tunnelStatusSource,
+				serviceProvider:    tt.fields.serviceProvider,
+				rules:              tt.fields.rules,
+				oldStatus:          tt.fields.oldStatus,
 			}
 			if err := s.setConfiguredListenAddresses(tt.args.wanted); (err != nil) != tt.wantErr {
 				t.Errorf("setConfiguredListenAddresses() error = %v, wantErr %v", err, tt.wantErr)
@@ -254,11 +296,11 @@ func TestSshAegis_setConfiguredListenAddresses(t *testing.T) {
 
 func TestSshAegis_isUpdateNeeded(t *testing.T) {
 	type fields struct {
-		configWrapper        ConfigWrapper
-		tunnelStatusSource   TunnelStatusSource
-		serviceProvider      ServiceReloader
-		addressConfiguration map[TunnelStatus][]string
-		oldStatus            TunnelStatus
+		configWrapper      ConfigWrapper
+		tunnelStatusSource TunnelStatusSource
+		serviceProvider    ServiceReloader
+		rules              addressRules
+		oldStatus          TunnelStatus
 	}
 	type args struct {
 		wantedListenAddresses []string
@@ -273,11 +315,11 @@ func TestSshAegis_isUpdateNeeded(t *testing.T) {
 		{
 			name: "nothing to do, no wanted addresses",
 			fields: fields{
-				configWrapper:        &dummyConfigWrapper{config: []string{""}},
-				tunnelStatusSource:   nil,
-				serviceProvider:      nil,
-				addressConfiguration: nil,
-				oldStatus:            0,
+				configWrapper:      &dummyConfigWrapper{config: []string{""}},
+				tunnelStatusSource: nil,
+				serviceProvider:    nil,
+				rules:              nil,
+				oldStatus:          0,
 			},
 			args: args{
 				wantedListenAddresses: nil,
@@ -292,10 +334,10 @@ func TestSshAegis_isUpdateNeeded(t *testing.T) {
 					"Some option",
 					"Other option",
 				}},
-				tunnelStatusSource:   nil,
-				serviceProvider:      nil,
-				addressConfiguration: nil,
-				oldStatus:            0,
+				tunnelStatusSource: nil,
+				serviceProvider:    nil,
+				rules:              nil,
+				oldStatus:          0,
 			},
 			args: args{
 				wantedListenAddresses: []string{"1.2.3.4"},
@@ -311,10 +353,10 @@ func TestSshAegis_isUpdateNeeded(t *testing.T) {
 					"Other option",
 					"ListenAddress 4.3.2.1",
 				}},
-				tunnelStatusSource:   nil,
-				serviceProvider:      nil,
-				addressConfiguration: nil,
-				oldStatus:            0,
+				tunnelStatusSource: nil,
+				serviceProvider:    nil,
+				rules:              nil,
+				oldStatus:          0,
 			},
 			args: args{
 				wantedListenAddresses: []string{"1.2.3.4"},
@@ -330,10 +372,10 @@ func TestSshAegis_isUpdateNeeded(t *testing.T) {
 					"Other option",
 					"ListenAddress 1.2.3.4",
 				}},
-				tunnelStatusSource:   nil,
-				serviceProvider:      nil,
-				addressConfiguration: nil,
-				oldStatus:            0,
+				tunnelStatusSource: nil,
+				serviceProvider:    nil,
+				rules:              nil,
+				oldStatus:          0,
 			},
 			args: args{
 				wantedListenAddresses: []string{"1.2.3.4"},
@@ -341,15 +383,55 @@ func TestSshAegis_isUpdateNeeded(t *testing.T) {
 			want:    false,
 			wantErr: false,
 		},
+		{
+			name: "needs update, port differs",
+			fields: fields{
+				configWrapper: &dummyConfigWrapper{config: []string{
+					"ListenAddress 1.2.3.4:22",
+				}},
+			},
+			args: args{
+				wantedListenAddresses: []string{"1.2.3.4:2222"},
+			},
+			want:    true,
+			wantErr: false,
+		},
+		{
+			name: "needs update, rdomain differs",
+			fields: fields{
+				configWrapper: &dummyConfigWrapper{config: []string{
+					"ListenAddress 1.2.3.4 rdomain vrf0",
+				}},
+			},
+			args: args{
+				wantedListenAddresses: []string{"1.2.3.4"},
+			},
+			want:    true,
+			wantErr: false,
+		},
+		{
+			name: "no update needed, equal after normalization",
+			fields: fields{
+				configWrapper: &dummyConfigWrapper{config: []string{
+					"ListenAddress [fd00::1]:2222",
+					"ListenAddress  0.0.0.0   rdomain vrf0",
+				}},
+			},
+			args: args{
+				wantedListenAddresses: []string{"0.0.0.0 rdomain vrf0", "[fd00:0::1]:2222"},
+			},
+			want:    false,
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := &SshAegis{
-				configWrapper:        tt.fields.configWrapper,
-				tunnelStatusSource:   tt.fields.tunnelStatusSource,
-				serviceProvider:      tt.fields.serviceProvider,
-				addressConfiguration: tt.fields.addressConfiguration,
-				oldStatus:            tt.fields.oldStatus,
+				configWrapper:      tt.fields.configWrapper,
+				tunnelStatusSource: tt.fields.tunnelStatusSource,
+				serviceProvider:    tt.fields.serviceProvider,
+				rules:              tt.fields.rules,
+				oldStatus:          tt.fields.oldStatus,
 			}
 			got, err := s.isUpdateNeeded(tt.args.wantedListenAddresses)
 			if (err != nil) != tt.wantErr {
@@ -362,3 +444,892 @@ func TestSshAegis_isUpdateNeeded(t *testing.T) {
 		})
 	}
 }
+
+type dummyConfigValidator struct {
+	err error
+}
+
+func (d *dummyConfigValidator) ValidateConfig(_ []string) error {
+	return d.err
+}
+
+type dummyServiceReloader struct {
+	restartErrs []error
+	restarts    int
+}
+
+func (d *dummyServiceReloader) RestartSsh() error {
+	d.restarts++
+	if len(d.restartErrs) == 0 {
+		return nil
+	}
+	err := d.restartErrs[0]
+	d.restartErrs = d.restartErrs[1:]
+	return err
+}
+
+func (d *dummyServiceReloader) UnitExists() error {
+	return nil
+}
+
+func TestSshAegis_upsert(t *testing.T) {
+	initialConfig := []string{
+		"Some option",
+		"ListenAddress 0.0.0.0",
+	}
+
+	tests := []struct {
+		name            string
+		configValidator ConfigValidator
+		serviceProvider *dummyServiceReloader
+		wantErr         bool
+		wantConfig      []string
+		wantRestarts    int
+	}{
+		{
+			name:            "config applied",
+			configValidator: &dummyConfigValidator{},
+			serviceProvider: &dummyServiceReloader{},
+			wantErr:         false,
+			wantConfig: []string{
+				"Some option",
+				"ListenAddress 10.8.0.1",
+			},
+			wantRestarts: 1,
+		},
+		{
+			name:            "config rejected by validator",
+			configValidator: &dummyConfigValidator{err: errors.New("bad config")},
+			serviceProvider: &dummyServiceReloader{},
+			wantErr:         true,
+			wantConfig:      initialConfig,
+			wantRestarts:    0,
+		},
+		{
+			name:            "restart fails, rolled back",
+			configValidator: &dummyConfigValidator{},
+			serviceProvider: &dummyServiceReloader{restartErrs: []error{errors.New("failed")}},
+			wantErr:         true,
+			wantConfig:      initialConfig,
+			wantRestarts:    2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SshAegis{
+				configWrapper:   &dummyConfigWrapper{config: slices.Clone(initialConfig)},
+				serviceProvider: tt.serviceProvider,
+				configValidator: tt.configValidator,
+				rules:           newLegacyAddressRules([]string{"10.8.0.1"}, []string{"0.0.0.0"}, nil),
+			}
+			if err := s.upsert(Up); (err != nil) != tt.wantErr {
+				t.Errorf("upsert() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			config, _ := s.configWrapper.GetConfig()
+			if !reflect.DeepEqual(config, tt.wantConfig) {
+				t.Errorf("upsert() config = %v, wantConfig %v", config, tt.wantConfig)
+			}
+
+			if tt.serviceProvider.restarts != tt.wantRestarts {
+				t.Errorf("upsert() restarts = %d, want %d", tt.serviceProvider.restarts, tt.wantRestarts)
+			}
+		})
+	}
+}
+
+func TestSshAegis_isUpdateNeededEffective(t *testing.T) {
+	tests := []struct {
+		name    string
+		main    string
+		dropIn  string
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:   "no update needed",
+			main:   "Include sshd_config.d/*.conf\nPort 22\n",
+			dropIn: "ListenAddress 10.8.0.1\n",
+		},
+		{
+			name:   "update needed",
+			main:   "Include sshd_config.d/*.conf\nPort 22\n",
+			dropIn: "ListenAddress 0.0.0.0\n",
+			want:   true,
+		},
+		{
+			name:    "listen address outside of managed file",
+			main:    "Include sshd_config.d/*.conf\nListenAddress 0.0.0.0\n",
+			dropIn:  "ListenAddress 10.8.0.1\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			mainFile := filepath.Join(dir, "sshd_config")
+			dropInFile := filepath.Join(dir, "sshd_config.d", "00-ssh-aegis.conf")
+			writeTestFile(t, mainFile, tt.main)
+			writeTestFile(t, dropInFile, tt.dropIn)
+
+			wrapper, err := NewSshDropInWrapper(mainFile, dropInFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wrapper.includeDir = dir
+			s := &SshAegis{configWrapper: wrapper}
+			got, err := s.isUpdateNeeded([]string{"10.8.0.1"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("isUpdateNeeded() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("isUpdateNeeded() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSshAegis_reconcileEffective(t *testing.T) {
+	metrics.ConfigDrift = 0
+	dir := t.TempDir()
+	mainFile := filepath.Join(dir, "sshd_config")
+	dropInFile := filepath.Join(dir, "sshd_config.d", "00-ssh-aegis.conf")
+	writeTestFile(t, mainFile, "Include sshd_config.d/*.conf\nPort 22\n")
+	writeTestFile(t, dropInFile, "ListenAddress 10.8.0.1\n")
+
+	wrapper, err := NewSshDropInWrapper(mainFile, dropInFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapper.includeDir = dir
+	s := &SshAegis{
+		configWrapper: wrapper,
+		rules:         newLegacyAddressRules([]string{"10.8.0.1"}, []string{"0.0.0.0"}, nil),
+		driftMode:     driftModeAlert,
+	}
+
+	s.reconcile(Up)
+	if metrics.ConfigDrift != 0 {
+		t.Errorf("reconcile() drift = %d, want 0", metrics.ConfigDrift)
+	}
+
+	// the managed file is unchanged, but sshd listens on another address as well
+	writeTestFile(t, mainFile, "Include sshd_config.d/*.conf\nListenAddress 0.0.0.0\n")
+	s.reconcile(Up)
+	if metrics.ConfigDrift != 1 {
+		t.Errorf("reconcile() drift with listen address outside of managed file = %d, want 1", metrics.ConfigDrift)
+	}
+}
+
+func TestSshAegis_reconcileEffectiveRepair(t *testing.T) {
+	metrics.ConfigDrift = 0
+	metrics.DriftRepairs = 0
+	dir := t.TempDir()
+	mainFile := filepath.Join(dir, "sshd_config")
+	dropInFile := filepath.Join(dir, "sshd_config.d", "00-ssh-aegis.conf")
+	writeTestFile(t, mainFile, "Include sshd_config.d/*.conf\nListenAddress 0.0.0.0\n")
+	writeTestFile(t, dropInFile, "ListenAddress 10.8.0.1\n")
+
+	wrapper, err := NewSshDropInWrapper(mainFile, dropInFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapper.includeDir = dir
+	serviceProvider := &dummyServiceReloader{}
+	s := &SshAegis{
+		configWrapper:   wrapper,
+		serviceProvider: serviceProvider,
+		configValidator: &dummyConfigValidator{},
+		rules:           newLegacyAddressRules([]string{"10.8.0.1"}, []string{"0.0.0.0"}, nil),
+		driftMode:       driftModeRepair,
+	}
+
+	// the drift is caused by the main file, rewriting the managed file can not repair it
+	s.reconcile(Up)
+	s.reconcile(Up)
+	if metrics.ConfigDrift != 1 {
+		t.Errorf("reconcile() drift = %d, want 1", metrics.ConfigDrift)
+	}
+	if metrics.DriftRepairs != 0 {
+		t.Errorf("reconcile() repairs = %d, want 0", metrics.DriftRepairs)
+	}
+	if serviceProvider.restarts != 0 {
+		t.Errorf("reconcile() restarts = %d, want 0", serviceProvider.restarts)
+	}
+}
+
+type dummyStatusSource struct {
+	status TunnelStatus
+}
+
+func (d *dummyStatusSource) GetStatus() TunnelStatus {
+	return d.status
+}
+
+func TestSshAegis_Plan(t *testing.T) {
+	initialConfig := []string{
+		"Some option",
+		"ListenAddress 0.0.0.0",
+	}
+
+	tests := []struct {
+		name       string
+		status     TunnelStatus
+		want       bool
+		wantErr    bool
+		wantOutput string
+	}{
+		{
+			name:   "changes pending",
+			status: Up,
+			want:   true,
+			wantOutput: "--- sshd_config\n+++ sshd_config\n" +
+				"@@ -1,2 +1,2 @@\n" +
+				" Some option\n" +
+				"-ListenAddress 0.0.0.0\n" +
+				"+ListenAddress 10.8.0.1\n" +
+				"Would restart sshd\n",
+		},
+		{
+			name:       "no changes",
+			status:     Down,
+			want:       false,
+			wantOutput: "",
+		},
+		{
+			name:       "unknown without addresses",
+			status:     Unknown,
+			want:       false,
+			wantOutput: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &strings.Builder{}
+			configWrapper := &dummyConfigWrapper{config: slices.Clone(initialConfig)}
+			serviceProvider := &dummyServiceReloader{}
+			s := &SshAegis{
+				configWrapper:      newDryRunConfigWrapper(configWrapper, "sshd_config", out),
+				tunnelStatusSource: &dummyStatusSource{status: tt.status},
+				serviceProvider:    &dryRunServiceReloader{wrapped: serviceProvider, unitName: "sshd", out: out},
+				rules:              newLegacyAddressRules([]string{"10.8.0.1"}, []string{"0.0.0.0"}, nil),
+			}
+			got, err := s.Plan(s.ReadStatus())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Plan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Plan() got = %v, want %v", got, tt.want)
+			}
+			if out.String() != tt.wantOutput {
+				t.Errorf("Plan() output = %q, want %q", out.String(), tt.wantOutput)
+			}
+			if !reflect.DeepEqual(configWrapper.config, initialConfig) {
+				t.Errorf("Plan() modified config = %v", configWrapper.config)
+			}
+			if serviceProvider.restarts != 0 {
+				t.Errorf("Plan() restarted ssh %d times", serviceProvider.restarts)
+			}
+		})
+	}
+}
+
+func TestSshAegis_Apply(t *testing.T) {
+	initialConfig := []string{
+		"Some option",
+		"ListenAddress 0.0.0.0",
+	}
+
+	tests := []struct {
+		name         string
+		oldStatus    TunnelStatus
+		status       TunnelStatus
+		restartErrs  []error
+		wantErr      bool
+		wantConfig   []string
+		wantRestarts int
+	}{
+		{
+			name:      "status changed",
+			oldStatus: Down,
+			status:    Up,
+			wantConfig: []string{
+				"Some option",
+				"ListenAddress 10.8.0.1",
+			},
+			wantRestarts: 1,
+		},
+		{
+			name:         "same status, config matches",
+			oldStatus:    Down,
+			status:       Down,
+			wantConfig:   initialConfig,
+			wantRestarts: 0,
+		},
+		{
+			name:      "same status, config reconciled",
+			oldStatus: Up,
+			status:    Up,
+			wantConfig: []string{
+				"Some option",
+				"ListenAddress 10.8.0.1",
+			},
+			wantRestarts: 1,
+		},
+		{
+			name:         "restart fails",
+			oldStatus:    Down,
+			status:       Up,
+			restartErrs:  []error{errors.New("failed")},
+			wantErr:      true,
+			wantConfig:   initialConfig,
+			wantRestarts: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceProvider := &dummyServiceReloader{restartErrs: tt.restartErrs}
+			s := &SshAegis{
+				configWrapper:   &dummyConfigWrapper{config: slices.Clone(initialConfig)},
+				serviceProvider: serviceProvider,
+				oldStatus:       tt.oldStatus,
+				rules:           newLegacyAddressRules([]string{"10.8.0.1"}, []string{"0.0.0.0"}, nil),
+			}
+			if err := s.Apply(tt.status); (err != nil) != tt.wantErr {
+				t.Errorf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			config, _ := s.configWrapper.GetConfig()
+			if !reflect.DeepEqual(config, tt.wantConfig) {
+				t.Errorf("Apply() config = %v, wantConfig %v", config, tt.wantConfig)
+			}
+			if serviceProvider.restarts != tt.wantRestarts {
+				t.Errorf("Apply() restarts = %d, want %d", serviceProvider.restarts, tt.wantRestarts)
+			}
+			if s.oldStatus != tt.status {
+				t.Errorf("Apply() status = %v, want %v", s.oldStatus, tt.status)
+			}
+		})
+	}
+}
+
+type dummySourceStatusReporter struct {
+	dummyStatusSource
+	sources map[string]TunnelStatus
+}
+
+func (d *dummySourceStatusReporter) SourceStatuses() map[string]TunnelStatus {
+	return d.sources
+}
+
+func TestSshAegis_CheckRules(t *testing.T) {
+	rules, err := compileAddressRules(testSiteRules, []string{"wg0", "wg1"})
+	if err != nil {
+		t.Fatalf("compileAddressRules() error = %v", err)
+	}
+
+	source := &dummySourceStatusReporter{dummyStatusSource: dummyStatusSource{status: Up}}
+	configWrapper := &dummyConfigWrapper{config: []string{"ListenAddress 0.0.0.0"}}
+	serviceProvider := &dummyServiceReloader{}
+	s := &SshAegis{
+		configWrapper:      configWrapper,
+		tunnelStatusSource: source,
+		serviceProvider:    serviceProvider,
+		rules:              rules,
+	}
+
+	steps := []struct {
+		sources      map[string]TunnelStatus
+		wantConfig   []string
+		wantRestarts int
+	}{
+		{
+			sources:      map[string]TunnelStatus{"wg0": Up, "wg1": Down},
+			wantConfig:   []string{"ListenAddress 10.8.0.1"},
+			wantRestarts: 1,
+		},
+		{
+			sources:      map[string]TunnelStatus{"wg0": Up, "wg1": Up},
+			wantConfig:   []string{"ListenAddress 10.8.0.1", "ListenAddress 10.9.0.1"},
+			wantRestarts: 2,
+		},
+		{
+			sources:      map[string]TunnelStatus{"wg0": Up, "wg1": Up},
+			wantConfig:   []string{"ListenAddress 10.8.0.1", "ListenAddress 10.9.0.1"},
+			wantRestarts: 2,
+		},
+		{
+			sources:      map[string]TunnelStatus{"wg0": Down, "wg1": Up},
+			wantConfig:   []string{"ListenAddress 10.9.0.1"},
+			wantRestarts: 3,
+		},
+	}
+	for idx, step := range steps {
+		source.sources = step.sources
+		s.Check()
+		if !reflect.DeepEqual(configWrapper.config, step.wantConfig) {
+			t.Errorf("step %d: Check() config = %v, want %v", idx, configWrapper.config, step.wantConfig)
+		}
+		if serviceProvider.restarts != step.wantRestarts {
+			t.Errorf("step %d: Check() restarts = %d, want %d", idx, serviceProvider.restarts, step.wantRestarts)
+		}
+	}
+}
+
+func TestSshAegis_ForcedStatusRules(t *testing.T) {
+	rules, err := compileAddressRules([]AddressRule{
+		{Sources: map[string]string{"wg0": "up"}, Addresses: []string{"10.8.0.1"}},
+		{Addresses: []string{"0.0.0.0"}},
+	}, []string{"wg0"})
+	if err != nil {
+		t.Fatalf("compileAddressRules() error = %v", err)
+	}
+
+	build := func(config []string) (*SshAegis, *dummyConfigWrapper) {
+		source, err := NewCompositeStatus([]namedStatusSource{{name: "wg0", source: &dummyStatusSource{status: Up}}}, 1)
+		if err != nil {
+			t.Fatalf("NewCompositeStatus() error = %v", err)
+		}
+		configWrapper := &dummyConfigWrapper{config: config}
+		return &SshAegis{
+			configWrapper:      configWrapper,
+			tunnelStatusSource: source,
+			serviceProvider:    &dummyServiceReloader{},
+			rules:              rules,
+		}, configWrapper
+	}
+
+	// the status is forced without reading it, the sources still need to be read to evaluate the rules
+	s, configWrapper := build([]string{"ListenAddress 0.0.0.0"})
+	if err := s.Apply(Up); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if want := []string{"ListenAddress 10.8.0.1"}; !reflect.DeepEqual(configWrapper.config, want) {
+		t.Errorf("Apply() config = %v, want %v", configWrapper.config, want)
+	}
+
+	s, _ = build([]string{"ListenAddress 10.8.0.1"})
+	if changesPending, err := s.Plan(Up); err != nil || changesPending {
+		t.Errorf("Plan() = %v, %v, want false, nil", changesPending, err)
+	}
+
+	s, _ = build([]string{"ListenAddress 10.8.0.1"})
+	s.stateStore, err = NewStateStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.stateStore.Save(State{Status: Up.String(), Addresses: []string{"10.8.0.1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RestoreState(); err != nil {
+		t.Fatalf("RestoreState() error = %v", err)
+	}
+	if !s.checked || s.oldStatus != Up {
+		t.Errorf("RestoreState() did not restore status up, checked = %v, status = %v", s.checked, s.oldStatus)
+	}
+}
+
+func TestSshAegis_CheckDrift(t *testing.T) {
+	tests := []struct {
+		name         string
+		driftMode    string
+		wantConfig   []string
+		wantRestarts int
+		wantDrift    int
+		wantRepairs  int
+	}{
+		{
+			name:         "repair",
+			driftMode:    driftModeRepair,
+			wantConfig:   []string{"ListenAddress 10.8.0.1"},
+			wantRestarts: 2,
+			wantDrift:    0,
+			wantRepairs:  1,
+		},
+		{
+			name:         "alert",
+			driftMode:    driftModeAlert,
+			wantConfig:   []string{"ListenAddress 0.0.0.0"},
+			wantRestarts: 1,
+			wantDrift:    1,
+		},
+		{
+			name:         "ignore",
+			driftMode:    driftModeIgnore,
+			wantConfig:   []string{"ListenAddress 0.0.0.0"},
+			wantRestarts: 1,
+			wantDrift:    0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics.ConfigDrift = 0
+			metrics.DriftRepairs = 0
+			configWrapper := &dummyConfigWrapper{config: []string{"ListenAddress 0.0.0.0"}}
+			serviceProvider := &dummyServiceReloader{}
+			s := &SshAegis{
+				configWrapper:      configWrapper,
+				tunnelStatusSource: &dummyStatusSource{status: Up},
+				serviceProvider:    serviceProvider,
+				rules:              newLegacyAddressRules([]string{"10.8.0.1"}, []string{"0.0.0.0"}, nil),
+				driftMode:          tt.driftMode,
+			}
+
+			s.Check()
+			// simulate an external edit of the sshd config
+			configWrapper.config = []string{"ListenAddress 0.0.0.0"}
+			s.Check()
+
+			if !reflect.DeepEqual(configWrapper.config, tt.wantConfig) {
+				t.Errorf("Check() config = %v, want %v", configWrapper.config, tt.wantConfig)
+			}
+			if serviceProvider.restarts != tt.wantRestarts {
+				t.Errorf("Check() restarts = %d, want %d", serviceProvider.restarts, tt.wantRestarts)
+			}
+			if metrics.ConfigDrift != tt.wantDrift {
+				t.Errorf("Check() drift = %d, want %d", metrics.ConfigDrift, tt.wantDrift)
+			}
+			if metrics.DriftRepairs != tt.wantRepairs {
+				t.Errorf("Check() repairs = %d, want %d", metrics.DriftRepairs, tt.wantRepairs)
+			}
+		})
+	}
+}
+
+func TestSshAegis_CheckLockout(t *testing.T) {
+	metrics.LockoutActive = 0
+	metrics.LockoutReverts = 0
+
+	check := &dummyReachabilityCheck{}
+	watchdog, err := NewLockoutWatchdog(time.Minute, check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	watchdog.now = func() time.Time { return now }
+
+	source := &dummyStatusSource{status: Up}
+	configWrapper := &dummyConfigWrapper{config: []string{"ListenAddress 0.0.0.0"}}
+	serviceProvider := &dummyServiceReloader{}
+	s := &SshAegis{
+		configWrapper:      configWrapper,
+		tunnelStatusSource: source,
+		serviceProvider:    serviceProvider,
+		rules:              newLegacyAddressRules([]string{"10.8.0.1"}, []string{"0.0.0.0"}, nil),
+		watchdog:           watchdog,
+	}
+
+	steps := []struct {
+		name         string
+		status       TunnelStatus
+		elapsed      time.Duration
+		reachable    bool
+		wantConfig   []string
+		wantRestarts int
+		wantActive   int
+		wantReverts  int
+	}{
+		{
+			name:         "switch to up",
+			status:       Up,
+			wantConfig:   []string{"ListenAddress 10.8.0.1"},
+			wantRestarts: 1,
+		},
+		{
+			name:         "waiting for evidence",
+			status:       Up,
+			elapsed:      30 * time.Second,
+			wantConfig:   []string{"ListenAddress 10.8.0.1"},
+			wantRestarts: 1,
+		},
+		{
+			name:         "no evidence in time",
+			status:       Up,
+			elapsed:      30 * time.Second,
+			wantConfig:   []string{"ListenAddress 0.0.0.0"},
+			wantRestarts: 2,
+			wantActive:   1,
+			wantReverts:  1,
+		},
+		{
+			name:         "override kept while up",
+			status:       Up,
+			elapsed:      time.Hour,
+			wantConfig:   []string{"ListenAddress 0.0.0.0"},
+			wantRestarts: 2,
+			wantActive:   1,
+			wantReverts:  1,
+		},
+		{
+			name:         "override lifted on status change",
+			status:       Down,
+			wantConfig:   []string{"ListenAddress 0.0.0.0"},
+			wantRestarts: 2,
+			wantReverts:  1,
+		},
+		{
+			name:         "switch to up again",
+			status:       Up,
+			wantConfig:   []string{"ListenAddress 10.8.0.1"},
+			wantRestarts: 3,
+			wantReverts:  1,
+		},
+		{
+			name:         "reachable",
+			status:       Up,
+			elapsed:      30 * time.Second,
+			reachable:    true,
+			wantConfig:   []string{"ListenAddress 10.8.0.1"},
+			wantRestarts: 3,
+			wantReverts:  1,
+		},
+		{
+			name:         "confirmed addresses kept",
+			status:       Up,
+			elapsed:      time.Hour,
+			wantConfig:   []string{"ListenAddress 10.8.0.1"},
+			wantRestarts: 3,
+			wantReverts:  1,
+		},
+	}
+	for _, step := range steps {
+		source.status = step.status
+		check.isReachable = step.reachable
+		now = now.Add(step.elapsed)
+		s.Check()
+		if !reflect.DeepEqual(configWrapper.config, step.wantConfig) {
+			t.Errorf("%s: Check() config = %v, want %v", step.name, configWrapper.config, step.wantConfig)
+		}
+		if serviceProvider.restarts != step.wantRestarts {
+			t.Errorf("%s: Check() restarts = %d, want %d", step.name, serviceProvider.restarts, step.wantRestarts)
+		}
+		if metrics.LockoutActive != step.wantActive {
+			t.Errorf("%s: Check() lockout active = %d, want %d", step.name, metrics.LockoutActive, step.wantActive)
+		}
+		if metrics.LockoutReverts != step.wantReverts {
+			t.Errorf("%s: Check() lockout reverts = %d, want %d", step.name, metrics.LockoutReverts, step.wantReverts)
+		}
+	}
+}
+
+type dummyFirewall struct {
+	configWrapper *dummyConfigWrapper
+	// calls records each call together with the config at the time of the call
+	calls       []string
+	restrictErr error
+}
+
+func (d *dummyFirewall) Restrict(addresses []string) error {
+	d.calls = append(d.calls, fmt.Sprintf("restrict %v %v", addresses, d.configWrapper.config))
+	return d.restrictErr
+}
+
+func (d *dummyFirewall) Lift() error {
+	d.calls = append(d.calls, fmt.Sprintf("lift %v", d.configWrapper.config))
+	return nil
+}
+
+func TestSshAegis_CheckFirewall(t *testing.T) {
+	source := &dummyStatusSource{status: Up}
+	configWrapper := &dummyConfigWrapper{config: []string{"ListenAddress 0.0.0.0"}}
+	firewall := &dummyFirewall{configWrapper: configWrapper}
+	s := &SshAegis{
+		configWrapper:      configWrapper,
+		tunnelStatusSource: source,
+		serviceProvider:    &dummyServiceReloader{},
+		rules:              newLegacyAddressRules([]string{"10.8.0.1"}, []string{"0.0.0.0"}, []string{"10.8.0.1"}),
+		firewall:           firewall,
+	}
+
+	steps := []struct {
+		status         TunnelStatus
+		restrictErr    error
+		wantCalls      []string
+		wantRestricted int
+	}{
+		{
+			status:    Up,
+			wantCalls: []string{"lift [ListenAddress 10.8.0.1]"},
+		},
+		{
+			status:         Down,
+			wantCalls:      []string{"restrict [0.0.0.0] [ListenAddress 10.8.0.1]"},
+			wantRestricted: 1,
+		},
+		{
+			status:         Down,
+			wantCalls:      []string{"restrict [0.0.0.0] [ListenAddress 0.0.0.0]"},
+			wantRestricted: 1,
+		},
+		{
+			status:    Unknown,
+			wantCalls: []string{"lift [ListenAddress 10.8.0.1]"},
+		},
+		{
+			status:    Up,
+			wantCalls: []string{"lift [ListenAddress 10.8.0.1]"},
+		},
+		{
+			status:      Down,
+			restrictErr: errors.New("nothing resolves"),
+			wantCalls:   []string{"restrict [0.0.0.0] [ListenAddress 10.8.0.1]"},
+		},
+		{
+			status:         Down,
+			wantCalls:      []string{"restrict [0.0.0.0] [ListenAddress 0.0.0.0]"},
+			wantRestricted: 1,
+		},
+	}
+	for idx, step := range steps {
+		firewall.calls = nil
+		firewall.restrictErr = step.restrictErr
+		source.status = step.status
+		s.Check()
+		if !reflect.DeepEqual(firewall.calls, step.wantCalls) {
+			t.Errorf("step %d: Check() firewall calls = %v, want %v", idx, firewall.calls, step.wantCalls)
+		}
+		if metrics.FirewallRestricted != step.wantRestricted {
+			t.Errorf("step %d: Check() restricted = %d, want %d", idx, metrics.FirewallRestricted, step.wantRestricted)
+		}
+	}
+}
+
+type dummyListenVerifier struct {
+	listening []string
+}
+
+func (d *dummyListenVerifier) VerifyListening(addresses []string) error {
+	if !sameListenAddresses(addresses, d.listening) {
+		return fmt.Errorf("not listening on %v", addresses)
+	}
+	return nil
+}
+
+func TestSshAegis_upsertFallback(t *testing.T) {
+	tests := []struct {
+		name          string
+		listening     []string
+		wantErr       bool
+		wantConfig    []string
+		wantRestarts  int
+		wantFallbacks int
+	}{
+		{
+			name:         "listening on wanted addresses",
+			listening:    []string{"10.8.0.1"},
+			wantConfig:   []string{"ListenAddress 10.8.0.1"},
+			wantRestarts: 1,
+		},
+		{
+			name:          "fallback to down addresses",
+			listening:     []string{"0.0.0.0"},
+			wantErr:       true,
+			wantConfig:    []string{"ListenAddress 0.0.0.0"},
+			wantRestarts:  2,
+			wantFallbacks: 1,
+		},
+		{
+			name:          "fallback fails as well",
+			listening:     nil,
+			wantErr:       true,
+			wantConfig:    []string{"ListenAddress 0.0.0.0"},
+			wantRestarts:  2,
+			wantFallbacks: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics.ListenFallbacks = 0
+			configWrapper := &dummyConfigWrapper{config: []string{"ListenAddress 192.168.0.1"}}
+			serviceProvider := &dummyServiceReloader{}
+			s := &SshAegis{
+				configWrapper:   configWrapper,
+				serviceProvider: serviceProvider,
+				listenVerifier:  &dummyListenVerifier{listening: tt.listening},
+				rules:           newLegacyAddressRules([]string{"10.8.0.1"}, []string{"0.0.0.0"}, nil),
+			}
+
+			if err := s.upsert(Up); (err != nil) != tt.wantErr {
+				t.Errorf("upsert() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(configWrapper.config, tt.wantConfig) {
+				t.Errorf("upsert() config = %v, want %v", configWrapper.config, tt.wantConfig)
+			}
+			if serviceProvider.restarts != tt.wantRestarts {
+				t.Errorf("upsert() restarts = %d, want %d", serviceProvider.restarts, tt.wantRestarts)
+			}
+			if metrics.ListenFallbacks != tt.wantFallbacks {
+				t.Errorf("upsert() fallbacks = %d, want %d", metrics.ListenFallbacks, tt.wantFallbacks)
+			}
+		})
+	}
+}
+
+func TestSshAegis_CheckLockoutWithoutSwitch(t *testing.T) {
+	metrics.LockoutActive = 0
+	metrics.LockoutReverts = 0
+
+	watchdog, err := NewLockoutWatchdog(time.Minute, &dummyReachabilityCheck{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	watchdog.now = func() time.Time { return now }
+
+	// the addresses for status up have been applied already, e.g. by a one-shot run from a hook
+	s := &SshAegis{
+		configWrapper:      &dummyConfigWrapper{config: []string{"ListenAddress 10.8.0.1"}},
+		tunnelStatusSource: &dummyStatusSource{status: Up},
+		serviceProvider:    &dummyServiceReloader{},
+		rules:              newLegacyAddressRules([]string{"10.8.0.1"}, nil, nil),
+		oldStatus:          Down,
+		watchdog:           watchdog,
+	}
+
+	s.Check()
+	if !watchdog.armed() {
+		t.Fatalf("Check() did not arm watchdog")
+	}
+
+	// there are no addresses to revert to
+	now = now.Add(time.Hour)
+	s.Check()
+	if metrics.LockoutActive != 0 || metrics.LockoutReverts != 0 {
+		t.Errorf("Check() lockout active = %d, reverts = %d, want 0, 0", metrics.LockoutActive, metrics.LockoutReverts)
+	}
+}
+
+func TestSshAegis_CheckFallbackKept(t *testing.T) {
+	source := &dummyStatusSource{status: Up}
+	configWrapper := &dummyConfigWrapper{config: []string{"ListenAddress 192.168.0.1"}}
+	serviceProvider := &dummyServiceReloader{}
+	s := &SshAegis{
+		configWrapper:      configWrapper,
+		tunnelStatusSource: source,
+		serviceProvider:    serviceProvider,
+		listenVerifier:     &dummyListenVerifier{listening: []string{"0.0.0.0"}},
+		rules:              newLegacyAddressRules([]string{"10.8.0.1"}, []string{"0.0.0.0"}, nil),
+		oldStatus:          Unknown,
+		driftMode:          driftModeRepair,
+	}
+
+	// the fallback is kept instead of switching back and forth on every check
+	for range 5 {
+		s.Check()
+	}
+	if want := []string{"ListenAddress 0.0.0.0"}; !reflect.DeepEqual(configWrapper.config, want) {
+		t.Errorf("Check() config = %v, want %v", configWrapper.config, want)
+	}
+	if serviceProvider.restarts != 2 {
+		t.Errorf("Check() restarts = %d, want 2", serviceProvider.restarts)
+	}
+
+	// the wanted addresses are tried again after the status changed
+	source.status = Down
+	s.Check()
+	source.status = Up
+	s.Check()
+	if serviceProvider.restarts != 4 {
+		t.Errorf("Check() restarts after status change = %d, want 4", serviceProvider.restarts)
+	}
+}
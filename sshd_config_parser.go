@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	sshdKeywordListenAddress = "listenaddress"
+	sshdKeywordInclude       = "include"
+	sshdKeywordMatch         = "match"
+	sshdKeywordPort          = "port"
+
+	// same limit as READCONF_MAX_DEPTH in OpenSSH
+	sshdMaxIncludeDepth = 16
+
+	// sshdIncludeDir is the dir sshd resolves relative include paths against, regardless of where the including file
+	// is located
+	sshdIncludeDir = "/etc/ssh"
+)
+
+// sshdConfigLine is a single parsed line of an sshd config. The raw line is kept so untouched lines can be written
+// back byte-for-byte.
+type sshdConfigLine struct {
+	Raw string
+	// Keyword is lower-cased as sshd treats keywords case-insensitively. It's empty for blank lines and comments.
+	Keyword string
+	Args    []string
+	// InMatch is true for Match lines and all lines that follow a Match line, as they only apply conditionally.
+	InMatch bool
+	File    string
+	LineNo  int
+	Err     error
+}
+
+// parseSshdConfig parses the lines of an sshd config without following Include directives.
+func parseSshdConfig(file string, lines []string) []sshdConfigLine {
+	parsed := make([]sshdConfigLine, len(lines))
+	inMatch := false
+	for idx, raw := range lines {
+		keyword, args, err := tokenizeSshdConfigLine(raw)
+		if keyword == sshdKeywordMatch {
+			inMatch = true
+		}
+
+		parsed[idx] = sshdConfigLine{
+			Raw:     raw,
+			Keyword: keyword,
+			Args:    args,
+			InMatch: inMatch,
+			File:    file,
+			LineNo:  idx + 1,
+			Err:     err,
+		}
+	}
+
+	return parsed
+}
+
+// tokenizeSshdConfigLine splits a line into its lower-cased keyword and arguments the way sshd does: the keyword is
+// separated from its arguments by whitespace and/or a single '=', arguments may be double-quoted and a '#' at the start
+// of a token starts a comment.
+func tokenizeSshdConfigLine(line string) (string, []string, error) {
+	rest := strings.TrimLeft(strings.TrimRight(line, "\r\n"), " \t")
+	if rest == "" || rest[0] == '#' {
+		return "", nil, nil
+	}
+
+	end := strings.IndexAny(rest, " \t=")
+	if end < 0 {
+		return strings.ToLower(rest), nil, nil
+	}
+
+	keyword := strings.ToLower(rest[:end])
+	rest = strings.TrimLeft(rest[end:], " \t")
+	if strings.HasPrefix(rest, "=") {
+		rest = strings.TrimLeft(rest[1:], " \t")
+	}
+
+	var args []string
+	for rest != "" {
+		if rest[0] == '#' {
+			break
+		}
+
+		var arg string
+		if rest[0] == '"' {
+			closing := strings.IndexByte(rest[1:], '"')
+			if closing < 0 {
+				return keyword, args, errors.New("unterminated quote")
+			}
+			arg = rest[1 : closing+1]
+			rest = rest[closing+2:]
+		} else {
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			arg = rest[:end]
+			rest = rest[end:]
+		}
+
+		args = append(args, arg)
+		rest = strings.TrimLeft(rest, " \t")
+	}
+
+	return keyword, args, nil
+}
+
+// loadSshdConfig reads and parses an sshd config, following Include directives. Relative include paths are resolved
+// against baseDir. Lines of included files inherit the Match scope of the Include directive.
+func loadSshdConfig(file string, baseDir string) ([]sshdConfigLine, error) {
+	return loadSshdConfigRecursive(file, baseDir, false, 0)
+}
+
+func loadSshdConfigRecursive(file string, baseDir string, inMatch bool, depth int) ([]sshdConfigLine, error) {
+	if depth > sshdMaxIncludeDepth {
+		return nil, fmt.Errorf("too many nested includes at %q", file)
+	}
+
+	lines, err := readLines(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []sshdConfigLine
+	for _, line := range parseSshdConfig(file, lines) {
+		line.InMatch = line.InMatch || inMatch
+		ret = append(ret, line)
+		if line.Keyword != sshdKeywordInclude {
+			continue
+		}
+
+		for _, included := range expandInclude(line.Args, baseDir) {
+			includedLines, err := loadSshdConfigRecursive(included, baseDir, line.InMatch, depth+1)
+			if err != nil {
+				return nil, fmt.Errorf("could not read %q included from %s:%d: %w", included, line.File, line.LineNo, err)
+			}
+			ret = append(ret, includedLines...)
+		}
+	}
+
+	return ret, nil
+}
+
+// expandInclude returns the files matched by the glob patterns of an Include directive in lexical order.
+func expandInclude(patterns []string, baseDir string) []string {
+	var files []string
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(resolveIncludePattern(pattern, baseDir))
+		slices.Sort(matches)
+		files = append(files, matches...)
+	}
+
+	return files
+}
+
+// includeDirOrDefault returns the given dir to resolve relative include paths against or sshdIncludeDir if it's empty.
+func includeDirOrDefault(dir string) string {
+	if dir == "" {
+		return sshdIncludeDir
+	}
+
+	return dir
+}
+
+func resolveIncludePattern(pattern string, baseDir string) string {
+	if filepath.IsAbs(pattern) {
+		return pattern
+	}
+
+	return filepath.Join(baseDir, pattern)
+}
+
+func readLines(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_tokenizeSshdConfigLine(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		wantKeyword string
+		wantArgs    []string
+		wantErr     bool
+	}{
+		{name: "empty line", line: "", wantKeyword: "", wantArgs: nil},
+		{name: "comment", line: "  # ListenAddress 1.2.3.4", wantKeyword: "", wantArgs: nil},
+		{name: "simple", line: "ListenAddress 1.2.3.4", wantKeyword: "listenaddress", wantArgs: []string{"1.2.3.4"}},
+		{name: "tab separated", line: "ListenAddress\t1.2.3.4", wantKeyword: "listenaddress", wantArgs: []string{"1.2.3.4"}},
+		{name: "indented", line: "\t  listenaddress 1.2.3.4", wantKeyword: "listenaddress", wantArgs: []string{"1.2.3.4"}},
+		{name: "equals sign", line: "ListenAddress=1.2.3.4", wantKeyword: "listenaddress", wantArgs: []string{"1.2.3.4"}},
+		{name: "equals sign with spaces", line: "ListenAddress = 1.2.3.4", wantKeyword: "listenaddress", wantArgs: []string{"1.2.3.4"}},
+		{name: "multiple args", line: "ListenAddress 1.2.3.4 rdomain vrf0", wantKeyword: "listenaddress", wantArgs: []string{"1.2.3.4", "rdomain", "vrf0"}},
+		{name: "trailing comment", line: "Port 22 # default", wantKeyword: "port", wantArgs: []string{"22"}},
+		{name: "quoted arg", line: `Banner "/etc/ssh/my banner"`, wantKeyword: "banner", wantArgs: []string{"/etc/ssh/my banner"}},
+		{name: "carriage return", line: "Port 22\r", wantKeyword: "port", wantArgs: []string{"22"}},
+		{name: "keyword only", line: "Match", wantKeyword: "match", wantArgs: nil},
+		{name: "unterminated quote", line: `Banner "/etc/ssh/banner`, wantKeyword: "banner", wantArgs: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyword, args, err := tokenizeSshdConfigLine(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("tokenizeSshdConfigLine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if keyword != tt.wantKeyword {
+				t.Errorf("tokenizeSshdConfigLine() keyword = %q, want %q", keyword, tt.wantKeyword)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("tokenizeSshdConfigLine() args = %q, want %q", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func Test_loadSshdConfig(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"sshd_config":             "Include sshd_config.d/*.conf\nListenAddress 0.0.0.0\nMatch User backup\n  Include match.d/*.conf\n",
+		"sshd_config.d/10-b.conf": "ListenAddress 10.0.0.2\n",
+		"sshd_config.d/00-a.conf": "ListenAddress 10.0.0.1\n",
+		"match.d/forced.conf":     "ForceCommand internal-sftp\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines, err := loadSshdConfig(filepath.Join(dir, "sshd_config"), dir)
+	if err != nil {
+		t.Fatalf("loadSshdConfig() error = %v", err)
+	}
+
+	type summary struct {
+		File    string
+		Keyword string
+		InMatch bool
+	}
+	var got []summary
+	for _, line := range lines {
+		rel, _ := filepath.Rel(dir, line.File)
+		got = append(got, summary{File: rel, Keyword: line.Keyword, InMatch: line.InMatch})
+	}
+
+	want := []summary{
+		{File: "sshd_config", Keyword: "include"},
+		{File: "sshd_config.d/00-a.conf", Keyword: "listenaddress"},
+		{File: "sshd_config.d/10-b.conf", Keyword: "listenaddress"},
+		{File: "sshd_config", Keyword: "listenaddress"},
+		{File: "sshd_config", Keyword: "match", InMatch: true},
+		{File: "sshd_config", Keyword: "include", InMatch: true},
+		{File: "match.d/forced.conf", Keyword: "forcecommand", InMatch: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadSshdConfig() = %v, want %v", got, want)
+	}
+}
+
+func Test_loadSshdConfig_includeLoop(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "sshd_config")
+	if err := os.WriteFile(file, []byte("Include sshd_config\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadSshdConfig(file, dir); err == nil {
+		t.Errorf("loadSshdConfig() expected error for recursive include")
+	}
+}
+
+func TestSshConfigWrapper_roundTrip(t *testing.T) {
+	original := "Port 22\r\n  listenaddress\t1.2.3.4  # keep me\n\n# comment\nMatch User root\n\tX11Forwarding no\n"
+	file := filepath.Join(t.TempDir(), "sshd_config")
+	if err := os.WriteFile(file, []byte(original), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &SshConfigWrapper{sshConfigFile: file}
+	lines, err := s.GetConfig()
+	if err != nil {
+		t.Fatalf("GetConfig() error = %v", err)
+	}
+	if err := s.WriteConfig(lines); err != nil {
+		t.Fatalf("WriteConfig() error = %v", err)
+	}
+
+	written, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != original {
+		t.Errorf("round trip changed config: got %q, want %q", written, original)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// SshdValidator validates candidate sshd configurations using 'sshd -t' before they are put in place. If a base config
+// is set, the candidate is a drop-in and is validated together with the base config it gets included from.
+type SshdValidator struct {
+	sshdBinary string
+	stagingDir string
+	baseConfig string
+}
+
+func NewSshdValidator(sshdBinary string, stagingDir string, baseConfig string) (*SshdValidator, error) {
+	if sshdBinary == "" {
+		return nil, errors.New("empty sshd binary provided")
+	}
+
+	if stagingDir == "" {
+		return nil, errors.New("empty staging dir provided")
+	}
+
+	return &SshdValidator{
+		sshdBinary: sshdBinary,
+		stagingDir: stagingDir,
+		baseConfig: baseConfig,
+	}, nil
+}
+
+func (v *SshdValidator) ValidateConfig(data []string) error {
+	candidate, err := os.CreateTemp(v.stagingDir, ".ssh-aegis-candidate-*")
+	if err != nil {
+		return fmt.Errorf("could not create staging file: %w", err)
+	}
+	defer os.Remove(candidate.Name())
+
+	writer := bufio.NewWriter(candidate)
+	for _, line := range data {
+		if _, err := writer.WriteString(line + "\n"); err != nil {
+			_ = candidate.Close()
+			return err
+		}
+	}
+
+	if v.baseConfig != "" {
+		// sshd uses the first value obtained for most keywords, so the candidate needs to be read first
+		if _, err := writer.WriteString(fmt.Sprintf("Include %s\n", v.baseConfig)); err != nil {
+			_ = candidate.Close()
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		_ = candidate.Close()
+		return err
+	}
+
+	if err := candidate.Close(); err != nil {
+		return err
+	}
+
+	//nolint G204
+	cmd := exec.Command(v.sshdBinary, "-t", "-f", candidate.Name())
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("sshd rejected candidate config: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
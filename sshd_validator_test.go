@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSshdValidator_ValidateConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		sshdBinary string
+		wantErr    bool
+	}{
+		{
+			name:       "config accepted",
+			sshdBinary: "true",
+			wantErr:    false,
+		},
+		{
+			name:       "config rejected",
+			sshdBinary: "false",
+			wantErr:    true,
+		},
+		{
+			name:       "binary not found",
+			sshdBinary: "/nonexistent/sshd",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stagingDir := t.TempDir()
+			v, err := NewSshdValidator(tt.sshdBinary, stagingDir, "")
+			if err != nil {
+				t.Fatalf("NewSshdValidator() error = %v", err)
+			}
+
+			if err := v.ValidateConfig([]string{"ListenAddress 1.2.3.4"}); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			entries, err := os.ReadDir(stagingDir)
+			if err != nil {
+				t.Fatalf("could not read staging dir: %v", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("ValidateConfig() left %d staging files behind", len(entries))
+			}
+		})
+	}
+}
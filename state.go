@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+const stateFileMode = 0o600
+
+// State is persisted across restarts of ssh-aegis.
+type State struct {
+	Status           string   `json:"status"`
+	LastStatusChange int64    `json:"last_status_change"`
+	Addresses        []string `json:"addresses"`
+	// OriginalAddresses are the addresses configured before ssh-aegis changed them for the first time. They are only
+	// persisted if restore_on_exit is enabled, nil means no addresses have been saved.
+	OriginalAddresses []string `json:"original_addresses"`
+	// LockoutConfirmed is true if ssh has been confirmed reachable on the addresses for status up, so the lockout
+	// watchdog is not armed again after restarting.
+	LockoutConfirmed bool `json:"lockout_confirmed,omitempty"`
+}
+
+type StateStore struct {
+	stateFile string
+	fs        fileSystem
+}
+
+func NewStateStore(stateFile string) (*StateStore, error) {
+	if stateFile == "" {
+		return nil, errors.New("empty state file provided")
+	}
+
+	return &StateStore{
+		stateFile: stateFile,
+		fs:        osFileSystem{},
+	}, nil
+}
+
+// Load returns the persisted state or nil if no state has been persisted yet.
+func (s *StateStore) Load() (*State, error) {
+	data, err := os.ReadFile(s.stateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("could not parse state file %q: %w", s.stateFile, err)
+	}
+
+	return &state, nil
+}
+
+func (s *StateStore) Save(state State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.fs, s.stateFile, data, stateFileMode)
+}
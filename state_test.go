@@ -0,0 +1,283 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStateStore(t *testing.T) {
+	store, err := NewStateStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("NewStateStore() error = %v", err)
+	}
+
+	state, err := store.Load()
+	if err != nil || state != nil {
+		t.Fatalf("Load() without state = %v, %v, want nil, nil", state, err)
+	}
+
+	want := State{
+		Status:           "up",
+		LastStatusChange: 1700000000,
+		Addresses:        []string{"10.8.0.1"},
+	}
+	if err := store.Save(want); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	state, err = store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(*state, want) {
+		t.Errorf("Load() = %v, want %v", *state, want)
+	}
+
+	if err := os.WriteFile(store.stateFile, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(); err == nil {
+		t.Errorf("Load() expected error for malformed state")
+	}
+}
+
+func TestSshAegis_RestoreState(t *testing.T) {
+	tests := []struct {
+		name           string
+		state          *State
+		config         []string
+		wantErr        bool
+		wantStatus     TunnelStatus
+		wantChecked    bool
+		wantLastChange int64
+	}{
+		{
+			name:           "no persisted state",
+			state:          nil,
+			config:         []string{"ListenAddress 10.8.0.1"},
+			wantStatus:     Unknown,
+			wantChecked:    false,
+			wantLastChange: 0,
+		},
+		{
+			name:           "config matches persisted status",
+			state:          &State{Status: "up", LastStatusChange: 1700000000, Addresses: []string{"10.8.0.1"}},
+			config:         []string{"ListenAddress 10.8.0.1"},
+			wantStatus:     Up,
+			wantChecked:    true,
+			wantLastChange: 1700000000,
+		},
+		{
+			name:           "config does not match persisted status",
+			state:          &State{Status: "up", LastStatusChange: 1700000000, Addresses: []string{"10.8.0.1"}},
+			config:         []string{"ListenAddress 0.0.0.0"},
+			wantStatus:     Unknown,
+			wantChecked:    false,
+			wantLastChange: 1700000000,
+		},
+		{
+			name:           "invalid persisted status",
+			state:          &State{Status: "sideways"},
+			config:         []string{"ListenAddress 10.8.0.1"},
+			wantErr:        true,
+			wantStatus:     Unknown,
+			wantChecked:    false,
+			wantLastChange: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics.LastStatusChange = 0
+			store, err := NewStateStore(filepath.Join(t.TempDir(), "state.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.state != nil {
+				if err := store.Save(*tt.state); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s := &SshAegis{
+				configWrapper: &dummyConfigWrapper{config: tt.config},
+				rules:         newLegacyAddressRules([]string{"10.8.0.1"}, []string{"0.0.0.0"}, nil),
+				oldStatus:     Unknown,
+				stateStore:    store,
+			}
+
+			if err := s.RestoreState(); (err != nil) != tt.wantErr {
+				t.Errorf("RestoreState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if s.oldStatus != tt.wantStatus {
+				t.Errorf("RestoreState() status = %v, want %v", s.oldStatus, tt.wantStatus)
+			}
+			if s.checked != tt.wantChecked {
+				t.Errorf("RestoreState() checked = %v, want %v", s.checked, tt.wantChecked)
+			}
+			if metrics.LastStatusChange != tt.wantLastChange {
+				t.Errorf("RestoreState() last status change = %d, want %d", metrics.LastStatusChange, tt.wantLastChange)
+			}
+		})
+	}
+}
+
+func TestSshAegis_RestoreStateLockout(t *testing.T) {
+	tests := []struct {
+		name       string
+		state      State
+		wantArmed  bool
+		wantStarts int
+	}{
+		{
+			name:       "not confirmed before restart",
+			state:      State{Status: "up", Addresses: []string{"10.8.0.1"}},
+			wantArmed:  true,
+			wantStarts: 1,
+		},
+		{
+			name:  "confirmed before restart",
+			state: State{Status: "up", Addresses: []string{"10.8.0.1"}, LockoutConfirmed: true},
+		},
+		{
+			name:  "down",
+			state: State{Status: "down", Addresses: []string{"0.0.0.0"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewStateStore(filepath.Join(t.TempDir(), "state.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Save(tt.state); err != nil {
+				t.Fatal(err)
+			}
+
+			check := &dummyReachabilityCheck{}
+			watchdog, err := NewLockoutWatchdog(time.Minute, check)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &SshAegis{
+				configWrapper: &dummyConfigWrapper{config: []string{"ListenAddress " + tt.state.Addresses[0]}},
+				rules:         newLegacyAddressRules([]string{"10.8.0.1"}, []string{"0.0.0.0"}, nil),
+				oldStatus:     Unknown,
+				stateStore:    store,
+				watchdog:      watchdog,
+			}
+
+			if err := s.RestoreState(); err != nil {
+				t.Fatalf("RestoreState() error = %v", err)
+			}
+			if watchdog.armed() != tt.wantArmed {
+				t.Errorf("RestoreState() armed = %v, want %v", watchdog.armed(), tt.wantArmed)
+			}
+			if check.starts != tt.wantStarts {
+				t.Errorf("RestoreState() check starts = %d, want %d", check.starts, tt.wantStarts)
+			}
+			if !tt.wantArmed {
+				return
+			}
+
+			// the confirmation is persisted, so the watchdog is not armed again after the next restart
+			check.isReachable = true
+			s.superviseLockout()
+			state, err := store.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !state.LockoutConfirmed {
+				t.Errorf("superviseLockout() persisted confirmation = false, want true")
+			}
+		})
+	}
+}
+
+func TestSshAegis_Shutdown(t *testing.T) {
+	tests := []struct {
+		name              string
+		restoreOnExit     bool
+		shutdownAddresses []string
+		state             *State
+		wantConfig        []string
+		wantOriginal      []string
+	}{
+		{
+			name:          "disabled",
+			restoreOnExit: false,
+			wantConfig:    []string{"ListenAddress 10.8.0.1", "Port 22"},
+			wantOriginal:  nil,
+		},
+		{
+			name:          "restore original addresses",
+			restoreOnExit: true,
+			wantConfig:    []string{"Port 22"},
+			wantOriginal:  nil,
+		},
+		{
+			name:              "apply shutdown addresses",
+			restoreOnExit:     true,
+			shutdownAddresses: []string{"0.0.0.0"},
+			wantConfig:        []string{"ListenAddress 0.0.0.0", "Port 22"},
+			wantOriginal:      []string{},
+		},
+		{
+			name:          "restore original addresses of previous run",
+			restoreOnExit: true,
+			state:         &State{Status: "unknown", OriginalAddresses: []string{"192.168.1.1"}},
+			wantConfig:    []string{"ListenAddress 192.168.1.1", "Port 22"},
+			wantOriginal:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewStateStore(filepath.Join(t.TempDir(), "state.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.state != nil {
+				if err := store.Save(*tt.state); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			configWrapper := &dummyConfigWrapper{config: []string{"Port 22"}}
+			s := &SshAegis{
+				configWrapper:      configWrapper,
+				tunnelStatusSource: &dummyStatusSource{status: Up},
+				serviceProvider:    &dummyServiceReloader{},
+				rules:              newLegacyAddressRules([]string{"10.8.0.1"}, []string{"0.0.0.0"}, nil),
+				oldStatus:          Unknown,
+				stateStore:         store,
+				restoreOnExit:      tt.restoreOnExit,
+				shutdownAddresses:  tt.shutdownAddresses,
+			}
+
+			if err := s.RestoreState(); err != nil {
+				t.Fatalf("RestoreState() error = %v", err)
+			}
+			if err := s.SnapshotListenAddresses(); err != nil {
+				t.Fatalf("SnapshotListenAddresses() error = %v", err)
+			}
+			s.Check()
+			if err := s.Shutdown(); err != nil {
+				t.Fatalf("Shutdown() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(configWrapper.config, tt.wantConfig) {
+				t.Errorf("Shutdown() config = %v, want %v", configWrapper.config, tt.wantConfig)
+			}
+
+			state, err := store.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(state.OriginalAddresses, tt.wantOriginal) {
+				t.Errorf("Shutdown() persisted original addresses = %#v, want %#v", state.OriginalAddresses, tt.wantOriginal)
+			}
+		})
+	}
+}
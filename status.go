@@ -1,8 +1,10 @@
 package main
 
 import (
-	"os/exec"
-	"strings"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
 )
 
 type TunnelStatus int
@@ -25,21 +27,86 @@ func (s TunnelStatus) String() string {
 	return "unknown"
 }
 
+func parseTunnelStatus(status string) (TunnelStatus, bool) {
+	for _, s := range []TunnelStatus{Up, Down, Unknown} {
+		if s.String() == status {
+			return s, true
+		}
+	}
+
+	return Unknown, false
+}
+
+// WgStatus reports a wireguard tunnel as up if its peers have completed a handshake recently. If no peers are
+// configured, a single peer with a recent handshake is sufficient, otherwise all configured peers are required to
+// have a recent handshake.
 type WgStatus struct {
-	interfaceName string
+	interfaceName   string
+	peers           []string
+	maxHandshakeAge time.Duration
+	reader          wgPeerReader
+	now             func() time.Time
+}
+
+func NewWgStatus(interfaceName string, peers []string, maxHandshakeAge time.Duration, reader wgPeerReader) (*WgStatus, error) {
+	if interfaceName == "" {
+		return nil, errors.New("empty interface name provided")
+	}
+
+	if reader == nil {
+		return nil, errors.New("no wg peer reader provided")
+	}
+
+	if maxHandshakeAge <= 0 {
+		return nil, errors.New("max handshake age must be positive")
+	}
+
+	return &WgStatus{
+		interfaceName:   interfaceName,
+		peers:           peers,
+		maxHandshakeAge: maxHandshakeAge,
+		reader:          reader,
+		now:             time.Now,
+	}, nil
 }
 
 func (w *WgStatus) GetStatus() TunnelStatus {
-	//nolint G204
-	cmd := exec.Command("wg", "show", w.interfaceName)
-	output, err := cmd.Output()
+	peers, err := w.reader.Peers(w.interfaceName)
 	if err != nil {
+		slog.Debug("could not read wireguard peers", "interface", w.interfaceName, "err", err)
+		return Down
+	}
+
+	for _, peer := range peers {
+		slog.Debug("Read wireguard peer", "interface", w.interfaceName, "peer", peer.PublicKey, "endpoint", peer.Endpoint,
+			"latest_handshake", peer.LatestHandshake, "rx_bytes", peer.RxBytes, "tx_bytes", peer.TxBytes)
+	}
+
+	return w.evaluate(peers)
+}
+
+func (w *WgStatus) evaluate(peers []WgPeer) TunnelStatus {
+	now := w.now()
+	isFresh := func(peer WgPeer) bool {
+		return !peer.LatestHandshake.IsZero() && now.Sub(peer.LatestHandshake) <= w.maxHandshakeAge
+	}
+
+	if len(w.peers) == 0 {
+		if slices.ContainsFunc(peers, isFresh) {
+			return Up
+		}
 		return Down
 	}
 
-	if strings.TrimSpace(string(output)) != "" {
-		return Up
+	for _, wantedPeer := range w.peers {
+		idx := slices.IndexFunc(peers, func(peer WgPeer) bool {
+			return peer.PublicKey == wantedPeer
+		})
+		if idx < 0 || !isFresh(peers[idx]) {
+			slog.Debug("Peer has no recent handshake", "interface", w.interfaceName, "peer", wantedPeer)
+			return Down
+		}
 	}
 
-	return Down
+	return Up
 }
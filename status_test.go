@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const (
+	testPeerA = "TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0="
+	testPeerB = "gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA="
+)
+
+type dummyPeerReader struct {
+	peers []WgPeer
+	err   error
+}
+
+func (d *dummyPeerReader) Peers(_ string) ([]WgPeer, error) {
+	return d.peers, d.err
+}
+
+func TestWgStatus_GetStatus(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	fresh := now.Add(-1 * time.Minute)
+	stale := now.Add(-10 * time.Minute)
+
+	tests := []struct {
+		name   string
+		peers  []string
+		reader *dummyPeerReader
+		want   TunnelStatus
+	}{
+		{
+			name:   "error reading peers",
+			reader: &dummyPeerReader{err: errors.New("no such device")},
+			want:   Down,
+		},
+		{
+			name:   "interface without peers",
+			reader: &dummyPeerReader{},
+			want:   Down,
+		},
+		{
+			name: "any peer, one fresh handshake",
+			reader: &dummyPeerReader{peers: []WgPeer{
+				{PublicKey: testPeerA, LatestHandshake: stale},
+				{PublicKey: testPeerB, LatestHandshake: fresh},
+			}},
+			want: Up,
+		},
+		{
+			name: "any peer, only stale handshakes",
+			reader: &dummyPeerReader{peers: []WgPeer{
+				{PublicKey: testPeerA, LatestHandshake: stale},
+				{PublicKey: testPeerB},
+			}},
+			want: Down,
+		},
+		{
+			name:  "configured peers, all fresh",
+			peers: []string{testPeerA, testPeerB},
+			reader: &dummyPeerReader{peers: []WgPeer{
+				{PublicKey: testPeerA, LatestHandshake: fresh},
+				{PublicKey: testPeerB, LatestHandshake: fresh},
+			}},
+			want: Up,
+		},
+		{
+			name:  "configured peers, one stale",
+			peers: []string{testPeerA, testPeerB},
+			reader: &dummyPeerReader{peers: []WgPeer{
+				{PublicKey: testPeerA, LatestHandshake: fresh},
+				{PublicKey: testPeerB, LatestHandshake: stale},
+			}},
+			want: Down,
+		},
+		{
+			name:  "configured peer missing",
+			peers: []string{testPeerB},
+			reader: &dummyPeerReader{peers: []WgPeer{
+				{PublicKey: testPeerA, LatestHandshake: fresh},
+			}},
+			want: Down,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &WgStatus{
+				interfaceName:   "wg0",
+				peers:           tt.peers,
+				maxHandshakeAge: 3 * time.Minute,
+				reader:          tt.reader,
+				now:             func() time.Time { return now },
+			}
+			if got := w.GetStatus(); got != tt.want {
+				t.Errorf("GetStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
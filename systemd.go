@@ -1,32 +1,102 @@
 package main
 
 import (
+	"bufio"
 	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os/exec"
+	"strconv"
+	"strings"
 )
 
 const defaultUnitName = "sshd"
 
 type Systemd struct {
 	unitName string
+	// resolvedUnit is the canonical id of the unit, e.g. 'ssh.service' when 'sshd' is only an alias
+	resolvedUnit string
 }
 
+func NewSystemd(unitName string) (*Systemd, error) {
+	if unitName == "" {
+		return nil, errors.New("empty unit name provided")
+	}
+
+	return &Systemd{unitName: unitName}, nil
+}
+
+// UnitExists checks whether the configured unit is known to systemd and resolves aliases to the unit's canonical id.
 func (w *Systemd) UnitExists() error {
+	unitName := cmp.Or(w.unitName, defaultUnitName)
+
 	//nolint G204
-	cmd := exec.Command("systemctl", "status", cmp.Or(w.unitName, defaultUnitName))
-	if err := cmd.Run(); err != nil {
-		return err
+	cmd := exec.Command("systemctl", "show", "-p", "Id", "-p", "LoadState", unitName)
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("could not query unit %q: %w", unitName, err)
 	}
 
+	properties := parseSystemctlShow(string(output))
+	if properties["LoadState"] == "not-found" {
+		return fmt.Errorf("unit %q not found", unitName)
+	}
+
+	if properties["Id"] == "" {
+		return fmt.Errorf("could not resolve id of unit %q", unitName)
+	}
+
+	w.resolvedUnit = properties["Id"]
+	slog.Info("Managing ssh unit", "configured", unitName, "resolved", w.resolvedUnit, "load_state", properties["LoadState"])
 	return nil
 }
 
 func (w *Systemd) RestartSsh() error {
 	//nolint G204
-	cmd := exec.Command("systemctl", "restart", cmp.Or(w.unitName, defaultUnitName))
+	cmd := exec.Command("systemctl", "restart", w.unit())
 	if err := cmd.Run(); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// MainPid returns the pid of the unit's main process.
+func (w *Systemd) MainPid() (int, error) {
+	//nolint G204
+	cmd := exec.Command("systemctl", "show", "-p", "MainPID", w.unit())
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("could not query main pid of unit %q: %w", w.unit(), err)
+	}
+
+	pid, err := strconv.Atoi(parseSystemctlShow(string(output))["MainPID"])
+	if err != nil {
+		return 0, fmt.Errorf("could not parse main pid of unit %q: %w", w.unit(), err)
+	}
+
+	if pid <= 0 {
+		return 0, fmt.Errorf("unit %q has no main process", w.unit())
+	}
+
+	return pid, nil
+}
+
+func (w *Systemd) unit() string {
+	return cmp.Or(w.resolvedUnit, w.unitName, defaultUnitName)
+}
+
+// parseSystemctlShow parses the 'key=value' lines printed by 'systemctl show'.
+func parseSystemctlShow(output string) map[string]string {
+	properties := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if found {
+			properties[key] = value
+		}
+	}
+
+	return properties
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseSystemctlShow(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   map[string]string
+	}{
+		{
+			name:   "alias resolved",
+			output: "Id=ssh.service\nLoadState=loaded\n",
+			want: map[string]string{
+				"Id":        "ssh.service",
+				"LoadState": "loaded",
+			},
+		},
+		{
+			name:   "unit not found",
+			output: "Id=sshd.service\nLoadState=not-found\n",
+			want: map[string]string{
+				"Id":        "sshd.service",
+				"LoadState": "not-found",
+			},
+		},
+		{
+			name:   "value containing separator",
+			output: "ExecStart=/usr/sbin/sshd -o Foo=bar\ngarbage\n",
+			want: map[string]string{
+				"ExecStart": "/usr/sbin/sshd -o Foo=bar",
+			},
+		},
+		{
+			name:   "empty output",
+			output: "",
+			want:   map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSystemctlShow(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSystemctlShow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSystemd_unit(t *testing.T) {
+	tests := []struct {
+		name    string
+		systemd *Systemd
+		want    string
+	}{
+		{
+			name:    "nothing configured",
+			systemd: &Systemd{},
+			want:    defaultUnitName,
+		},
+		{
+			name:    "configured unit",
+			systemd: &Systemd{unitName: "ssh"},
+			want:    "ssh",
+		},
+		{
+			name:    "resolved alias",
+			systemd: &Systemd{unitName: "sshd", resolvedUnit: "ssh.service"},
+			want:    "ssh.service",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.systemd.unit(); got != tt.want {
+				t.Errorf("unit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	wgKeyLength      = 32
+	wgBackendCli     = "wg"
+	wgBackendNetlink = "netlink"
+)
+
+var wgBackends = []string{wgBackendCli, wgBackendNetlink}
+
+type WgPeer struct {
+	PublicKey       string
+	Endpoint        string
+	LatestHandshake time.Time
+	RxBytes         uint64
+	TxBytes         uint64
+}
+
+type wgPeerReader interface {
+	Peers(interfaceName string) ([]WgPeer, error)
+}
+
+// wgCli reads the peers of a wireguard interface by invoking 'wg show <interface> dump'.
+type wgCli struct{}
+
+func (w *wgCli) Peers(interfaceName string) ([]WgPeer, error) {
+	//nolint G204
+	cmd := exec.Command("wg", "show", interfaceName, "dump")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not run 'wg show %s dump': %w", interfaceName, err)
+	}
+
+	return parseWgDump(string(output))
+}
+
+// parseWgDump parses the output of 'wg show <interface> dump'. The first line describes the interface itself and is
+// skipped, every other line describes a peer using tab-separated fields.
+func parseWgDump(output string) ([]WgPeer, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) == "" {
+		return nil, errors.New("empty output")
+	}
+
+	var peers []WgPeer
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 8 {
+			return nil, fmt.Errorf("malformed peer line, expected 8 fields, got %d", len(fields))
+		}
+
+		handshake, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed latest handshake %q: %w", fields[4], err)
+		}
+
+		rx, err := strconv.ParseUint(fields[5], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed rx bytes %q: %w", fields[5], err)
+		}
+
+		tx, err := strconv.ParseUint(fields[6], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed tx bytes %q: %w", fields[6], err)
+		}
+
+		peer := WgPeer{
+			PublicKey: fields[0],
+			RxBytes:   rx,
+			TxBytes:   tx,
+		}
+		if fields[2] != "(none)" {
+			peer.Endpoint = fields[2]
+		}
+		if handshake > 0 {
+			peer.LatestHandshake = time.Unix(handshake, 0)
+		}
+		peers = append(peers, peer)
+	}
+
+	return peers, nil
+}
+
+func newWgPeerReader(backend string) (wgPeerReader, error) {
+	switch backend {
+	case wgBackendCli:
+		return &wgCli{}, nil
+	case wgBackendNetlink:
+		return &wgNetlink{}, nil
+	default:
+		return nil, fmt.Errorf("unknown wg backend %q", backend)
+	}
+}
+
+func isValidWgKey(key string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	return err == nil && len(decoded) == wgKeyLength
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// constants taken from linux/genetlink.h and linux/wireguard.h
+const (
+	genlIdCtrl              = 0x10
+	genlHeaderLen           = 4
+	ctrlCmdGetFamily        = 3
+	ctrlAttrFamilyId        = 1
+	ctrlAttrFamilyName      = 2
+	wgGenlName              = "wireguard"
+	wgGenlVersion           = 1
+	wgCmdGetDevice          = 0
+	wgDeviceAttrIfname      = 2
+	wgDeviceAttrPeers       = 8
+	wgPeerAttrPublicKey     = 1
+	wgPeerAttrEndpoint      = 4
+	wgPeerAttrLastHandshake = 6
+	wgPeerAttrRxBytes       = 7
+	wgPeerAttrTxBytes       = 8
+)
+
+// wgNetlink reads the peers of a wireguard interface directly from the kernel using the wireguard generic netlink
+// family, so neither wireguard-tools nor a shell are needed.
+type wgNetlink struct{}
+
+func (w *wgNetlink) Peers(interfaceName string) ([]WgPeer, error) {
+	conn, err := newNetlinkConn(syscall.NETLINK_GENERIC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	familyId, err := resolveGenlFamily(conn, wgGenlName)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve generic netlink family %q, is the wireguard module loaded? %w", wgGenlName, err)
+	}
+
+	payload := append(genlHeader(wgCmdGetDevice, wgGenlVersion), encodeNlAttrString(wgDeviceAttrIfname, interfaceName)...)
+	msgs, err := conn.execute(familyId, syscall.NLM_F_DUMP, payload)
+	if err != nil {
+		return nil, fmt.Errorf("could not get wireguard device %q: %w", interfaceName, err)
+	}
+
+	var payloads [][]byte
+	for _, msg := range msgs {
+		if len(msg.Data) < genlHeaderLen {
+			return nil, errors.New("truncated generic netlink message")
+		}
+		payloads = append(payloads, msg.Data[genlHeaderLen:])
+	}
+
+	return parseWgDeviceMessages(payloads)
+}
+
+func genlHeader(cmd uint8, version uint8) []byte {
+	return []byte{cmd, version, 0, 0}
+}
+
+func resolveGenlFamily(conn *netlinkConn, name string) (uint16, error) {
+	payload := append(genlHeader(ctrlCmdGetFamily, 1), encodeNlAttrString(ctrlAttrFamilyName, name)...)
+	msgs, err := conn.execute(genlIdCtrl, 0, payload)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range msgs {
+		if len(msg.Data) < genlHeaderLen {
+			continue
+		}
+		attrs, err := parseNlAttrs(msg.Data[genlHeaderLen:])
+		if err != nil {
+			return 0, err
+		}
+		for _, attr := range attrs {
+			if attr.Type == ctrlAttrFamilyId && len(attr.Data) >= 2 {
+				return binary.NativeEndian.Uint16(attr.Data), nil
+			}
+		}
+	}
+
+	return 0, errors.New("family id not found in response")
+}
+
+// parseWgDeviceMessages parses the attributes of all messages of a WG_CMD_GET_DEVICE dump. The kernel splits large
+// peer lists across multiple messages and may repeat a peer if its data does not fit into a single message.
+func parseWgDeviceMessages(payloads [][]byte) ([]WgPeer, error) {
+	var peers []WgPeer
+	indices := map[string]int{}
+
+	for _, payload := range payloads {
+		attrs, err := parseNlAttrs(payload)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, attr := range attrs {
+			if attr.Type != wgDeviceAttrPeers {
+				continue
+			}
+
+			peerAttrs, err := parseNlAttrs(attr.Data)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, peerAttr := range peerAttrs {
+				peer, err := parseWgPeer(peerAttr.Data)
+				if err != nil {
+					return nil, err
+				}
+
+				if idx, found := indices[peer.PublicKey]; found {
+					mergeWgPeer(&peers[idx], peer)
+				} else {
+					indices[peer.PublicKey] = len(peers)
+					peers = append(peers, peer)
+				}
+			}
+		}
+	}
+
+	return peers, nil
+}
+
+func parseWgPeer(data []byte) (WgPeer, error) {
+	attrs, err := parseNlAttrs(data)
+	if err != nil {
+		return WgPeer{}, err
+	}
+
+	var peer WgPeer
+	for _, attr := range attrs {
+		switch attr.Type {
+		case wgPeerAttrPublicKey:
+			if len(attr.Data) != wgKeyLength {
+				return WgPeer{}, fmt.Errorf("invalid public key length %d", len(attr.Data))
+			}
+			peer.PublicKey = base64.StdEncoding.EncodeToString(attr.Data)
+		case wgPeerAttrEndpoint:
+			peer.Endpoint = parseSockaddr(attr.Data)
+		case wgPeerAttrLastHandshake:
+			// struct __kernel_timespec, two signed 64 bit integers
+			if len(attr.Data) < 16 {
+				return WgPeer{}, errors.New("truncated last handshake time")
+			}
+			sec := int64(binary.NativeEndian.Uint64(attr.Data[0:8]))   //nolint:gosec
+			nsec := int64(binary.NativeEndian.Uint64(attr.Data[8:16])) //nolint:gosec
+			if sec > 0 || nsec > 0 {
+				peer.LatestHandshake = time.Unix(sec, nsec)
+			}
+		case wgPeerAttrRxBytes:
+			if len(attr.Data) >= 8 {
+				peer.RxBytes = binary.NativeEndian.Uint64(attr.Data)
+			}
+		case wgPeerAttrTxBytes:
+			if len(attr.Data) >= 8 {
+				peer.TxBytes = binary.NativeEndian.Uint64(attr.Data)
+			}
+		}
+	}
+
+	if peer.PublicKey == "" {
+		return WgPeer{}, errors.New("peer without public key")
+	}
+
+	return peer, nil
+}
+
+func mergeWgPeer(dst *WgPeer, src WgPeer) {
+	if dst.Endpoint == "" {
+		dst.Endpoint = src.Endpoint
+	}
+	if dst.LatestHandshake.IsZero() {
+		dst.LatestHandshake = src.LatestHandshake
+	}
+	dst.RxBytes = max(dst.RxBytes, src.RxBytes)
+	dst.TxBytes = max(dst.TxBytes, src.TxBytes)
+}
+
+// parseSockaddr converts a struct sockaddr_in or sockaddr_in6 to its "host:port" representation.
+func parseSockaddr(data []byte) string {
+	if len(data) < 2 {
+		return ""
+	}
+
+	var ip net.IP
+	switch binary.NativeEndian.Uint16(data[0:2]) {
+	case syscall.AF_INET:
+		if len(data) < 8 {
+			return ""
+		}
+		ip = net.IP(data[4:8])
+	case syscall.AF_INET6:
+		if len(data) < 24 {
+			return ""
+		}
+		ip = net.IP(data[8:24])
+	default:
+		return ""
+	}
+
+	port := binary.BigEndian.Uint16(data[2:4])
+	return net.JoinHostPort(ip.String(), strconv.Itoa(int(port)))
+}
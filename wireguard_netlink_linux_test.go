@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func testEncodeWgPeer(t *testing.T, publicKey string, endpoint []byte, handshake int64, rx, tx uint64) []byte {
+	t.Helper()
+
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		t.Fatalf("invalid key: %v", err)
+	}
+
+	timespec := make([]byte, 16)
+	binary.NativeEndian.PutUint64(timespec[0:8], uint64(handshake)) //nolint:gosec
+	rxBytes := binary.NativeEndian.AppendUint64(nil, rx)
+	txBytes := binary.NativeEndian.AppendUint64(nil, tx)
+
+	var data []byte
+	data = append(data, encodeNlAttr(wgPeerAttrPublicKey, key)...)
+	if endpoint != nil {
+		data = append(data, encodeNlAttr(wgPeerAttrEndpoint, endpoint)...)
+	}
+	data = append(data, encodeNlAttr(wgPeerAttrLastHandshake, timespec)...)
+	data = append(data, encodeNlAttr(wgPeerAttrRxBytes, rxBytes)...)
+	data = append(data, encodeNlAttr(wgPeerAttrTxBytes, txBytes)...)
+	return encodeNlAttr(nlaFNested, data)
+}
+
+func testSockaddrInet4(ip [4]byte, port uint16) []byte {
+	data := make([]byte, 16)
+	binary.NativeEndian.PutUint16(data[0:2], syscall.AF_INET)
+	binary.BigEndian.PutUint16(data[2:4], port)
+	copy(data[4:8], ip[:])
+	return data
+}
+
+func Test_parseWgDeviceMessages(t *testing.T) {
+	peerA := testEncodeWgPeer(t, testPeerA, testSockaddrInet4([4]byte{192, 0, 2, 1}, 51820), 1700000000, 1024, 2048)
+	peerB := testEncodeWgPeer(t, testPeerB, nil, 0, 0, 0)
+	peerBContinued := testEncodeWgPeer(t, testPeerB, nil, 1700000100, 0, 0)
+
+	devicePrefix := encodeNlAttrString(wgDeviceAttrIfname, "wg0")
+
+	tests := []struct {
+		name     string
+		payloads [][]byte
+		want     []WgPeer
+		wantErr  bool
+	}{
+		{
+			name: "single message",
+			payloads: [][]byte{
+				append(devicePrefix, encodeNlAttr(wgDeviceAttrPeers|nlaFNested, append(peerA, peerB...))...),
+			},
+			want: []WgPeer{
+				{
+					PublicKey:       testPeerA,
+					Endpoint:        "192.0.2.1:51820",
+					LatestHandshake: time.Unix(1700000000, 0),
+					RxBytes:         1024,
+					TxBytes:         2048,
+				},
+				{
+					PublicKey: testPeerB,
+				},
+			},
+		},
+		{
+			name: "peer split across messages",
+			payloads: [][]byte{
+				append(devicePrefix, encodeNlAttr(wgDeviceAttrPeers|nlaFNested, peerB)...),
+				append(devicePrefix, encodeNlAttr(wgDeviceAttrPeers|nlaFNested, peerBContinued)...),
+			},
+			want: []WgPeer{
+				{
+					PublicKey:       testPeerB,
+					LatestHandshake: time.Unix(1700000100, 0),
+				},
+			},
+		},
+		{
+			name:     "no peers",
+			payloads: [][]byte{devicePrefix},
+			want:     nil,
+		},
+		{
+			name:     "truncated attribute",
+			payloads: [][]byte{{0xff, 0x00, 0x08, 0x00}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseWgDeviceMessages(tt.payloads)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseWgDeviceMessages() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseWgDeviceMessages() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
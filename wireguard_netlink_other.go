@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+type wgNetlink struct{}
+
+func (w *wgNetlink) Peers(_ string) ([]WgPeer, error) {
+	return nil, errors.New("netlink backend is only supported on linux")
+}
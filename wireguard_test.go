@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_parseWgDump(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    []WgPeer
+		wantErr bool
+	}{
+		{
+			name: "happy case",
+			output: "cHJpdmF0ZQ==\txTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\t51820\toff\n" +
+				"TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=\t(none)\t192.0.2.1:51820\t10.8.0.0/24\t1700000000\t1024\t2048\t25\n" +
+				"gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA=\t(none)\t(none)\t10.9.0.0/24\t0\t0\t0\toff\n",
+			want: []WgPeer{
+				{
+					PublicKey:       "TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=",
+					Endpoint:        "192.0.2.1:51820",
+					LatestHandshake: time.Unix(1700000000, 0),
+					RxBytes:         1024,
+					TxBytes:         2048,
+				},
+				{
+					PublicKey: "gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA=",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "no peers",
+			output:  "cHJpdmF0ZQ==\txTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\t51820\toff\n",
+			want:    nil,
+			wantErr: false,
+		},
+		{
+			name:    "empty output",
+			output:  "",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "malformed handshake",
+			output: "cHJpdmF0ZQ==\txTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\t51820\toff\n" +
+				"TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=\t(none)\t(none)\t10.8.0.0/24\tnever\t0\t0\toff\n",
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "missing fields",
+			output: "cHJpdmF0ZQ==\txTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\t51820\toff\n" +
+				"TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=\t(none)\n",
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseWgDump(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseWgDump() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseWgDump() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}